@@ -21,40 +21,292 @@
 
 package main
 
-import "github.com/distatus/battery"
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/distatus/battery"
+)
 
 type batteryResponse struct {
-	Charge  float32
-	Percent float32
-	State   string
+	Charge    float32
+	Percent   float32
+	State     string
+	Current   float32
+	Full      float32
+	Design    float32
+	Health    float32
+	Power     float32
+	Voltage   float32
+	Remaining time.Duration
+	AC        bool
+	Batteries []batteryResponse
+}
+
+type batterySample struct {
+	time   time.Time
+	energy float64
 }
 
 type Battery struct {
 	number int
+	all    bool
+
+	samples []batterySample
+	window  time.Duration
+	state   string
+
+	sysfs    string
+	interval time.Duration
+	events   <-chan []byte
 }
 
-func (b *Battery) Get() (interface{}, error) {
-	res, err := battery.Get(b.number)
+// parseUevent parses kernel uevent message, i.e. a header
+// (e.g. "change@/devices/...") followed by NUL separated KEY=VALUE pairs.
+func parseUevent(msg []byte) map[string]string {
+	uevent := make(map[string]string)
+	for _, field := range bytes.Split(msg, []byte{0}) {
+		split := strings.SplitN(string(field), "=", 2)
+		if len(split) == 2 {
+			uevent[split[0]] = split[1]
+		}
+	}
+	return uevent
+}
+
+// acOnline checks whether any AC adapter (a "Mains" power supply) is online.
+// Returns an error if there is no AC adapter at all.
+func acOnline(sysfs string) (bool, error) {
+	types, err := filepath.Glob(filepath.Join(sysfs, "class", "power_supply", "*", "type"))
 	if err != nil {
-		return nil, err
+		return false, err
+	}
+	found := false
+	for _, t := range types {
+		typ, err := ioutil.ReadFile(t)
+		if err != nil || strings.TrimSpace(string(typ)) != "Mains" {
+			continue
+		}
+		found = true
+		online, err := ioutil.ReadFile(filepath.Join(filepath.Dir(t), "online"))
+		if err == nil && strings.TrimSpace(string(online)) == "1" {
+			return true, nil
+		}
+	}
+	if !found {
+		return false, fmt.Errorf("No AC adapter found")
+	}
+	return false, nil
+}
+
+// aggregate sums up multiple batteries into a single one.
+func aggregate(batteries []*battery.Battery) *battery.Battery {
+	sum := &battery.Battery{State: batteries[0].State}
+	for _, bat := range batteries {
+		sum.Current += bat.Current
+		sum.Full += bat.Full
+		sum.Design += bat.Design
+		sum.ChargeRate += bat.ChargeRate
+		sum.Voltage += bat.Voltage / float64(len(batteries))
+		switch bat.State.String() {
+		case "Charging", "Discharging":
+			sum.State = bat.State
+		}
 	}
+	return sum
+}
 
-	charge := res.Current / res.Full
-	percent := float32(charge * 100)
-	// If battery controller does not work as expected.
-	if percent > 100 {
-		percent = 100
+// remaining estimates time to empty (when discharging) or to full (when charging).
+// `rate` is in mW, energies in mWh.
+func remaining(state string, current, full, rate float64) time.Duration {
+	if rate <= 0 {
+		return 0
 	}
-	return batteryResponse{
-		Charge:  float32(charge),
-		Percent: percent,
-		State:   res.State.String(),
-	}, nil
+	var hours float64
+	switch state {
+	case "Discharging":
+		hours = current / rate
+	case "Charging":
+		hours = (full - current) / rate
+	}
+	return time.Duration(hours*float64(time.Hour)) / time.Second * time.Second
+}
+
+// rate computes an average charge/discharge rate (in mW) over samples
+// from the last config:`samples` window. Samples are dropped whenever state
+// changes. Returns 0 if samples do not cover at least half of the window yet,
+// as energy is usually reported in coarse steps.
+func (b *Battery) rate(now time.Time, state string, energy float64) float64 {
+	if state != b.state {
+		b.samples = b.samples[:0]
+		b.state = state
+	}
+	b.samples = append(b.samples, batterySample{time: now, energy: energy})
+	old := 0
+	for old < len(b.samples)-1 && now.Sub(b.samples[old].time) > b.window {
+		old += 1
+	}
+	b.samples = b.samples[old:]
+
+	first, last := b.samples[0], b.samples[len(b.samples)-1]
+	span := last.time.Sub(first.time)
+	if span <= 0 || span < b.window/2 {
+		return 0
+	}
+	hours := span.Hours()
+	rate := (last.energy - first.energy) / hours
+	if rate < 0 {
+		rate = -rate
+	}
+	return rate
+}
+
+func newBatteryResponse(bat *battery.Battery) batteryResponse {
+	resp := batteryResponse{
+		State:   bat.State.String(),
+		Current: float32(bat.Current),
+		Full:    float32(bat.Full),
+		Design:  float32(bat.Design),
+		Power:   float32(bat.ChargeRate / 1000),
+		Voltage: float32(bat.Voltage),
+	}
+	if bat.Full > 0 {
+		charge := bat.Current / bat.Full
+		resp.Charge = float32(charge)
+		resp.Percent = float32(charge * 100)
+		// If battery controller does not work as expected.
+		if resp.Percent > 100 {
+			resp.Percent = 100
+		}
+	}
+	if bat.Design > 0 {
+		resp.Health = float32(bat.Full / bat.Design * 100)
+	}
+	resp.Remaining = remaining(resp.State, bat.Current, bat.Full, bat.ChargeRate)
+	return resp
+}
+
+func (b *Battery) Get() (interface{}, error) {
+	var batteries []*battery.Battery
+	if b.all {
+		all, err := battery.GetAll()
+		for _, bat := range all {
+			if bat != nil {
+				batteries = append(batteries, bat)
+			}
+		}
+		if len(batteries) == 0 {
+			if err == nil {
+				err = fmt.Errorf("No batteries found")
+			}
+			return nil, err
+		}
+	} else {
+		bat, err := battery.Get(b.number)
+		if err != nil {
+			return nil, err
+		}
+		batteries = []*battery.Battery{bat}
+	}
+
+	bat := aggregate(batteries)
+	resp := newBatteryResponse(bat)
+	if rate := b.rate(time.Now(), resp.State, bat.Current); rate > 0 {
+		resp.Remaining = remaining(resp.State, bat.Current, bat.Full, rate)
+	}
+	resp.AC, _ = acOnline(b.sysfs)
+	if b.all {
+		resp.Batteries = make([]batteryResponse, len(batteries))
+		for i, bat := range batteries {
+			resp.Batteries[i] = newBatteryResponse(bat)
+		}
+	}
+	return resp, nil
+}
+
+func (b *Battery) Evented() bool {
+	return b.events != nil
+}
+
+// wait blocks until a power supply uevent arrives, but no longer than
+// config:`pollInterval`, so that charge is still updated regularly.
+func (b *Battery) wait() {
+	timeout := time.After(b.interval)
+	for {
+		select {
+		case msg, ok := <-b.events:
+			if !ok {
+				// Listener is gone, keep on with timeouts only.
+				b.events = nil
+				continue
+			}
+			if parseUevent(msg)["SUBSYSTEM"] == "power_supply" {
+				return
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
+
+func (b *Battery) SetInterval(interval time.Duration) {
+	b.interval = interval
+}
+
+func (b *Battery) GetEvented() (interface{}, error) {
+	b.wait()
+	return b.Get()
 }
 
 func (b *Battery) Init(config config) error {
-	if config["number"] != nil {
-		b.number = int(config["number"].(int64))
+	switch number := config["number"].(type) {
+	case int64:
+		b.number = int(number)
+	case string:
+		if number != "all" {
+			return fmt.Errorf("Wrong battery number `%s`", number)
+		}
+		b.all = true
+	}
+	b.window = 5 * time.Minute
+	if config["samples"] != nil {
+		window, ok := config["samples"].(string)
+		if !ok {
+			return fmt.Errorf("Samples parameter must be a duration, got `%v`", config["samples"])
+		}
+		_window, err := time.ParseDuration(window)
+		if err != nil || _window <= 0 {
+			return fmt.Errorf("Wrong samples parameter `%s`", window)
+		}
+		b.window = _window
+	}
+
+	b.sysfs = "/sys"
+	if config["sysfs"] != nil {
+		b.sysfs = config["sysfs"].(string)
+	}
+
+	b.interval = time.Second
+	if config["pollInterval"] != nil {
+		interval, err := time.ParseDuration(config["pollInterval"].(string))
+		if err == nil {
+			b.interval = interval
+		}
+	}
+
+	b.events = nil
+	if config["evented"] != nil && config["evented"].(bool) {
+		events, err := listenUevents()
+		if err != nil {
+			log.Printf("Battery: Cannot listen for events, polling instead: `%s`\n", err)
+		} else {
+			b.events = events
+		}
 	}
 	return nil
 }
@@ -0,0 +1,70 @@
+// osop
+// Copyright (C) 2026 Karol 'Kenji Takahashi' Woźniak
+//
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+// OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"log"
+	"syscall"
+)
+
+// listenUevents subscribes to kernel uevents over netlink.
+// Every message is sent to the returned channel as is.
+func listenUevents() (<-chan []byte, error) {
+	fd, err := syscall.Socket(
+		syscall.AF_NETLINK,
+		syscall.SOCK_RAW|syscall.SOCK_CLOEXEC,
+		syscall.NETLINK_KOBJECT_UEVENT,
+	)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: 1,
+	})
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	ch := make(chan []byte)
+	go func() {
+		buf := make([]byte, 16384)
+		for {
+			n, err := syscall.Read(fd, buf)
+			if err == syscall.ENOBUFS || err == syscall.EINTR {
+				// Some messages were lost, but we can go on.
+				continue
+			}
+			if err != nil {
+				log.Printf("Cannot read uevent: `%s`\n", err)
+				syscall.Close(fd)
+				close(ch)
+				return
+			}
+			msg := make([]byte, n)
+			copy(msg, buf[:n])
+			ch <- msg
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,203 @@
+// osop
+// Copyright (C) 2026 Karol 'Kenji Takahashi' Woźniak
+//
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+// OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var RemainingTests = []struct {
+	state    string
+	current  float64
+	full     float64
+	rate     float64
+	expected time.Duration
+}{
+	{"Discharging", 30000, 50000, 10000, 3 * time.Hour},
+	{"Charging", 30000, 50000, 10000, 2 * time.Hour},
+	{"Charging", 30000, 50000, 0, 0},
+	{"Full", 50000, 50000, 10000, 0},
+	{"Discharging", 10000, 50000, 12000, 50 * time.Minute},
+}
+
+func TestRemaining(t *testing.T) {
+	for _, tt := range RemainingTests {
+		assert.Equal(t, tt.expected, remaining(tt.state, tt.current, tt.full, tt.rate))
+	}
+}
+
+func TestBatteryRate(t *testing.T) {
+	b := &Battery{}
+	assert.Nil(t, b.Init(config{"samples": "10m"}))
+	assert.Equal(t, 10*time.Minute, b.window)
+
+	// Energy changes in coarse steps, while polled every second.
+	now := time.Now()
+	assert.Equal(t, 0.0, b.rate(now, "Discharging", 40000))
+	assert.Equal(t, 0.0, b.rate(now.Add(time.Second), "Discharging", 40000))
+	assert.Equal(t, 0.0, b.rate(now.Add(30*time.Second), "Discharging", 39900))
+	// Not enough data until half of the window is covered.
+	assert.Equal(t, 0.0, b.rate(now.Add(4*time.Minute), "Discharging", 39200))
+	assert.Equal(t, 12000.0, b.rate(now.Add(5*time.Minute), "Discharging", 39000))
+	assert.Equal(t, 9000.0, b.rate(now.Add(10*time.Minute), "Discharging", 38500))
+	// Samples older than the window are dropped.
+	assert.Equal(t, 6000.0, b.rate(now.Add(15*time.Minute), "Discharging", 38000))
+	assert.Len(t, b.samples, 3)
+
+	// State change drops all samples.
+	assert.Equal(t, 0.0, b.rate(now.Add(20*time.Minute), "Charging", 37600))
+	assert.Equal(t, 1200.0, b.rate(now.Add(25*time.Minute), "Charging", 37700))
+
+	assert.NotNil(t, b.Init(config{"samples": int64(10)}))
+	assert.NotNil(t, b.Init(config{"samples": "often"}))
+	assert.NotNil(t, b.Init(config{"number": "first"}))
+	assert.Nil(t, b.Init(config{"number": "all"}))
+	assert.True(t, b.all)
+	assert.Equal(t, 5*time.Minute, b.window)
+}
+
+func TestParseUevent(t *testing.T) {
+	msg := []byte("change@/devices/LNXSYSTM:00/ACPI0003:00/power_supply/AC\x00" +
+		"ACTION=change\x00DEVPATH=/devices/LNXSYSTM:00/ACPI0003:00/power_supply/AC\x00" +
+		"SUBSYSTEM=power_supply\x00POWER_SUPPLY_NAME=AC\x00POWER_SUPPLY_ONLINE=1\x00SEQNUM=2417\x00")
+
+	assert.Equal(t, map[string]string{
+		"ACTION":              "change",
+		"DEVPATH":             "/devices/LNXSYSTM:00/ACPI0003:00/power_supply/AC",
+		"SUBSYSTEM":           "power_supply",
+		"POWER_SUPPLY_NAME":   "AC",
+		"POWER_SUPPLY_ONLINE": "1",
+		"SEQNUM":              "2417",
+	}, parseUevent(msg))
+}
+
+// writeFakeFiles creates files with given contents under root.
+func writeFakeFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+var ACOnlineTests = []struct {
+	files    map[string]string
+	expected bool
+	err      bool
+}{
+	{map[string]string{}, false, true},
+	{map[string]string{
+		"class/power_supply/BAT0/type": "Battery\n",
+	}, false, true},
+	{map[string]string{
+		"class/power_supply/BAT0/type": "Battery\n",
+		"class/power_supply/AC/type":   "Mains\n",
+		"class/power_supply/AC/online": "0\n",
+	}, false, false},
+	{map[string]string{
+		"class/power_supply/BAT0/type":   "Battery\n",
+		"class/power_supply/ADP0/type":   "Mains\n",
+		"class/power_supply/ADP0/online": "0\n",
+		"class/power_supply/ADP1/type":   "Mains\n",
+		"class/power_supply/ADP1/online": "1\n",
+	}, true, false},
+}
+
+func TestACOnline(t *testing.T) {
+	for _, tt := range ACOnlineTests {
+		root, err := ioutil.TempDir("", "osop")
+		assert.Nil(t, err)
+		writeFakeFiles(t, root, tt.files)
+
+		online, err := acOnline(root)
+		assert.Equal(t, tt.expected, online)
+		assert.Equal(t, tt.err, err != nil)
+
+		os.RemoveAll(root)
+	}
+}
+
+// waitBattery runs Battery.wait in the background.
+// Returned channel is closed when it returns.
+func waitBattery(b *Battery) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		b.wait()
+		close(done)
+	}()
+	return done
+}
+
+func TestBatteryEvented(t *testing.T) {
+	b := &Battery{}
+	assert.Nil(t, b.Init(config{"pollInterval": "5s"}))
+	assert.False(t, b.Evented())
+	assert.Equal(t, 5*time.Second, b.interval)
+	assert.Equal(t, "/sys", b.sysfs)
+
+	events := make(chan []byte)
+	b.events = events
+	assert.True(t, b.Evented())
+
+	// Other subsystems are ignored, power supply triggers a refresh.
+	done := waitBattery(b)
+	events <- []byte("add@/devices/usb1\x00SUBSYSTEM=usb\x00")
+	select {
+	case <-done:
+		t.Error("Refreshed on a non power supply event")
+	case <-time.After(50 * time.Millisecond):
+	}
+	events <- []byte("change@/devices/AC\x00SUBSYSTEM=power_supply\x00POWER_SUPPLY_ONLINE=0\x00")
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Not refreshed on a power supply event")
+	}
+
+	// With no events, refreshes after pollInterval.
+	b.interval = 50 * time.Millisecond
+	select {
+	case <-waitBattery(b):
+	case <-time.After(time.Second):
+		t.Error("Not refreshed after pollInterval")
+	}
+
+	// Closed listener drops back to timeouts.
+	close(events)
+	select {
+	case <-waitBattery(b):
+	case <-time.After(time.Second):
+		t.Error("Not refreshed after listener was closed")
+	}
+	assert.Nil(t, b.events)
+	select {
+	case <-waitBattery(b):
+	case <-time.After(time.Second):
+		t.Error("Not refreshed after pollInterval")
+	}
+}
@@ -0,0 +1,182 @@
+// osop
+// Copyright (C) 2026 Karol 'Kenji Takahashi' Woźniak
+//
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+// OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// templateDependencies walks template tree and gathers names
+// of all top level data fields (i.e. sections) it refers to.
+//
+// `root` tells whether dot points to the top level data in given node,
+// which is not the case inside `range` and `with` bodies.
+func templateDependencies(node parse.Node, root bool, names map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, node := range n.Nodes {
+			templateDependencies(node, root, names)
+		}
+	case *parse.ActionNode:
+		templateDependencies(n.Pipe, root, names)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			templateDependencies(cmd, root, names)
+		}
+	case *parse.CommandNode:
+		if name, ok := indexDependency(n, root); ok {
+			names[name] = true
+		}
+		for _, arg := range n.Args {
+			templateDependencies(arg, root, names)
+		}
+	case *parse.ChainNode:
+		templateDependencies(n.Node, root, names)
+	case *parse.FieldNode:
+		if root {
+			names[n.Ident[0]] = true
+		}
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			names[n.Ident[1]] = true
+		}
+	case *parse.IfNode:
+		templateDependencies(n.Pipe, root, names)
+		templateDependencies(n.List, root, names)
+		templateDependencies(n.ElseList, root, names)
+	case *parse.RangeNode:
+		templateDependencies(n.Pipe, root, names)
+		templateDependencies(n.List, false, names)
+		templateDependencies(n.ElseList, root, names)
+	case *parse.WithNode:
+		templateDependencies(n.Pipe, root, names)
+		templateDependencies(n.List, false, names)
+		templateDependencies(n.ElseList, root, names)
+	case *parse.TemplateNode:
+		templateDependencies(n.Pipe, root, names)
+	}
+}
+
+// indexDependency recognizes `index . "Name"` (and `index $ "Name"`)
+// commands, which refer to a section by its (quoted) name.
+func indexDependency(cmd *parse.CommandNode, root bool) (string, bool) {
+	if len(cmd.Args) < 3 {
+		return "", false
+	}
+	if ident, ok := cmd.Args[0].(*parse.IdentifierNode); !ok || ident.Ident != "index" {
+		return "", false
+	}
+	switch n := cmd.Args[1].(type) {
+	case *parse.DotNode:
+		if !root {
+			return "", false
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) != 1 || n.Ident[0] != "$" {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+	name, ok := cmd.Args[2].(*parse.StringNode)
+	if !ok {
+		return "", false
+	}
+	return name.Text, true
+}
+
+type Computed struct {
+	template     *template.Template
+	dependencies []string
+	number       bool
+}
+
+func (c *Computed) Get() (interface{}, error) {
+	return nil, nil
+}
+
+func (c *Computed) Dependencies() []string {
+	return c.dependencies
+}
+
+func (c *Computed) Compute(data map[string]interface{}) (interface{}, error) {
+	var buf bytes.Buffer
+	if err := c.template.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("Cannot execute template: `%s`", err)
+	}
+	if !c.number {
+		return buf.String(), nil
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(buf.String()), 64)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot convert `%s` to number", buf.String())
+	}
+	return number, nil
+}
+
+func (c *Computed) Init(config config) error {
+	if config["template"] == nil {
+		return fmt.Errorf("Template parameter is required for Computed receiver")
+	}
+
+	delims, ok := config["delims"].([]interface{})
+	if !ok {
+		delims = []interface{}{"<", ">"}
+	}
+	t, err := template.New("computed").Delims(
+		delims[0].(string), delims[1].(string),
+	).Funcs(templateFuncs).Parse(config["template"].(string))
+	if err != nil {
+		return fmt.Errorf("Cannot parse template: `%s`", err)
+	}
+	c.template = t
+
+	names := make(map[string]bool)
+	templateDependencies(t.Tree.Root, true, names)
+	c.dependencies = make([]string, 0, len(names))
+	for name := range names {
+		c.dependencies = append(c.dependencies, name)
+	}
+	sort.Strings(c.dependencies)
+
+	if config["number"] != nil {
+		c.number = config["number"].(bool)
+	}
+
+	return nil
+}
+
+func init() {
+	registry.AddReceiver("Computed", &Computed{}, "")
+}
@@ -22,22 +22,313 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// dateNames holds localized weekday and month names.
+type dateNames struct {
+	days        [7]string
+	shortDays   [7]string
+	months      [12]string
+	shortMonths [12]string
+}
+
+var dateLocales = map[string]dateNames{
+	"en": {
+		[7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		[7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+		[12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		[12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+	},
+	"de": {
+		[7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		[7]string{"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"},
+		[12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		[12]string{"Jan", "Feb", "Mär", "Apr", "Mai", "Jun", "Jul", "Aug", "Sep", "Okt", "Nov", "Dez"},
+	},
+	"es": {
+		[7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		[7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+		[12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		[12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sep", "oct", "nov", "dic"},
+	},
+	"fr": {
+		[7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		[7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+		[12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		[12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+	},
+	"it": {
+		[7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+		[7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+		[12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		[12]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+	},
+	"nl": {
+		[7]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+		[7]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+		[12]string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+		[12]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+	},
+	"pl": {
+		[7]string{"niedziela", "poniedziałek", "wtorek", "środa", "czwartek", "piątek", "sobota"},
+		[7]string{"nie", "pon", "wto", "śro", "czw", "pią", "sob"},
+		[12]string{"styczeń", "luty", "marzec", "kwiecień", "maj", "czerwiec", "lipiec", "sierpień", "wrzesień", "październik", "listopad", "grudzień"},
+		[12]string{"sty", "lut", "mar", "kwi", "maj", "cze", "lip", "sie", "wrz", "paź", "lis", "gru"},
+	},
+	"pt": {
+		[7]string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira", "sábado"},
+		[7]string{"dom", "seg", "ter", "qua", "qui", "sex", "sáb"},
+		[12]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+		[12]string{"jan", "fev", "mar", "abr", "mai", "jun", "jul", "ago", "set", "out", "nov", "dez"},
+	},
+}
+
+// formatLayout formats time using Go layout, but with localized names.
+//
+// Layout is split on name elements (e.g. "Monday", "Jan"), which are
+// substituted by hand, while the rest is formatted by time.Format.
+func formatLayout(t time.Time, layout string, names dateNames) string {
+	var buf bytes.Buffer
+	last := 0
+	for i := 0; i < len(layout); {
+		var name string
+		var n int
+		switch {
+		case strings.HasPrefix(layout[i:], "January"):
+			name, n = names.months[t.Month()-1], 7
+		case strings.HasPrefix(layout[i:], "Jan"):
+			name, n = names.shortMonths[t.Month()-1], 3
+		case strings.HasPrefix(layout[i:], "Monday"):
+			name, n = names.days[t.Weekday()], 6
+		case strings.HasPrefix(layout[i:], "Mon"):
+			name, n = names.shortDays[t.Weekday()], 3
+		default:
+			i += 1
+			continue
+		}
+		buf.WriteString(t.Format(layout[last:i]))
+		buf.WriteString(name)
+		i += n
+		last = i
+	}
+	buf.WriteString(t.Format(layout[last:]))
+	return buf.String()
+}
+
+// formatStrftime formats time using strftime(3) style format string.
+// Unknown conversion specifications are left untouched.
+func formatStrftime(t time.Time, format string, names dateNames) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			buf.WriteByte(format[i])
+			continue
+		}
+		i += 1
+		switch format[i] {
+		case 'a':
+			buf.WriteString(names.shortDays[t.Weekday()])
+		case 'A':
+			buf.WriteString(names.days[t.Weekday()])
+		case 'b', 'h':
+			buf.WriteString(names.shortMonths[t.Month()-1])
+		case 'B':
+			buf.WriteString(names.months[t.Month()-1])
+		case 'c':
+			buf.WriteString(formatStrftime(t, "%a %b %e %H:%M:%S %Y", names))
+		case 'C':
+			fmt.Fprintf(&buf, "%02d", t.Year()/100)
+		case 'd':
+			fmt.Fprintf(&buf, "%02d", t.Day())
+		case 'D':
+			buf.WriteString(formatStrftime(t, "%m/%d/%y", names))
+		case 'e':
+			fmt.Fprintf(&buf, "%2d", t.Day())
+		case 'F':
+			buf.WriteString(formatStrftime(t, "%Y-%m-%d", names))
+		case 'G':
+			year, _ := t.ISOWeek()
+			fmt.Fprintf(&buf, "%d", year)
+		case 'g':
+			year, _ := t.ISOWeek()
+			fmt.Fprintf(&buf, "%02d", year%100)
+		case 'H':
+			fmt.Fprintf(&buf, "%02d", t.Hour())
+		case 'I':
+			fmt.Fprintf(&buf, "%02d", (t.Hour()+11)%12+1)
+		case 'j':
+			fmt.Fprintf(&buf, "%03d", t.YearDay())
+		case 'k':
+			fmt.Fprintf(&buf, "%2d", t.Hour())
+		case 'l':
+			fmt.Fprintf(&buf, "%2d", (t.Hour()+11)%12+1)
+		case 'm':
+			fmt.Fprintf(&buf, "%02d", t.Month())
+		case 'M':
+			fmt.Fprintf(&buf, "%02d", t.Minute())
+		case 'n':
+			buf.WriteByte('\n')
+		case 'p':
+			buf.WriteString(t.Format("PM"))
+		case 'P':
+			buf.WriteString(t.Format("pm"))
+		case 'R':
+			buf.WriteString(formatStrftime(t, "%H:%M", names))
+		case 's':
+			buf.WriteString(strconv.FormatInt(t.Unix(), 10))
+		case 'S':
+			fmt.Fprintf(&buf, "%02d", t.Second())
+		case 't':
+			buf.WriteByte('\t')
+		case 'T':
+			buf.WriteString(formatStrftime(t, "%H:%M:%S", names))
+		case 'u':
+			fmt.Fprintf(&buf, "%d", (int(t.Weekday())+6)%7+1)
+		case 'U':
+			fmt.Fprintf(&buf, "%02d", (t.YearDay()+6-int(t.Weekday()))/7)
+		case 'V':
+			_, week := t.ISOWeek()
+			fmt.Fprintf(&buf, "%02d", week)
+		case 'w':
+			fmt.Fprintf(&buf, "%d", t.Weekday())
+		case 'W':
+			fmt.Fprintf(&buf, "%02d", (t.YearDay()+6-(int(t.Weekday())+6)%7)/7)
+		case 'y':
+			fmt.Fprintf(&buf, "%02d", t.Year()%100)
+		case 'Y':
+			fmt.Fprintf(&buf, "%d", t.Year())
+		case 'z':
+			buf.WriteString(t.Format("-0700"))
+		case 'Z':
+			buf.WriteString(t.Format("MST"))
+		case '%':
+			buf.WriteByte('%')
+		default:
+			buf.WriteByte('%')
+			buf.WriteByte(format[i])
+		}
+	}
+	return buf.String()
+}
+
+type dateTime struct {
+	Formatted string
+	Time      time.Time
+	Unix      int64
+	Zone      string
+	Weekday   string
+	Month     string
+	YearDay   int
+	ISOYear   int
+	ISOWeek   int
+}
+
+// String makes date print as formatted string when used directly in template.
+func (d dateTime) String() string {
+	return d.Formatted
+}
+
+type dateResponse struct {
+	dateTime
+	Zones map[string]dateTime
+}
+
 type Date struct {
-	format string
+	format   string
+	strftime bool
+	names    dateNames
+	location *time.Location
+	zones    map[string]*time.Location
+}
+
+func (d *Date) getDateTime(t time.Time) dateTime {
+	dt := dateTime{
+		Time:    t,
+		Unix:    t.Unix(),
+		Zone:    t.Format("MST"),
+		Weekday: d.names.days[t.Weekday()],
+		Month:   d.names.months[t.Month()-1],
+		YearDay: t.YearDay(),
+	}
+	dt.ISOYear, dt.ISOWeek = t.ISOWeek()
+	if d.strftime {
+		dt.Formatted = formatStrftime(t, d.format, d.names)
+	} else {
+		dt.Formatted = formatLayout(t, d.format, d.names)
+	}
+	return dt
 }
 
 func (d *Date) Get() (interface{}, error) {
-	return time.Now().Format(d.format), nil
+	now := time.Now()
+	resp := dateResponse{dateTime: d.getDateTime(now.In(d.location))}
+	if len(d.zones) > 0 {
+		resp.Zones = make(map[string]dateTime, len(d.zones))
+		for name, location := range d.zones {
+			resp.Zones[name] = d.getDateTime(now.In(location))
+		}
+	}
+	return resp, nil
 }
 
 func (d *Date) Init(config config) error {
-	d.format = config["format"].(string)
+	if config["format"] != nil {
+		d.format = config["format"].(string)
+	} else if config["strftime"] != nil {
+		d.format = config["strftime"].(string)
+		d.strftime = true
+	} else {
+		return fmt.Errorf("Either format or strftime parameter is required for Date receiver")
+	}
+
+	d.names = dateLocales["en"]
+	if config["locale"] != nil {
+		// Accept POSIX style locales, e.g. "de_DE.UTF-8".
+		locale := strings.FieldsFunc(
+			strings.ToLower(config["locale"].(string)),
+			func(r rune) bool { return r == '_' || r == '-' || r == '.' },
+		)
+		names, ok := dateNames{}, false
+		if len(locale) > 0 {
+			names, ok = dateLocales[locale[0]]
+		}
+		if !ok {
+			log.Printf("Unknown locale `%s`, using `en`\n", config["locale"])
+		} else {
+			d.names = names
+		}
+	}
+
+	d.location = time.Local
+	if config["zone"] != nil {
+		location, err := time.LoadLocation(config["zone"].(string))
+		if err != nil {
+			return fmt.Errorf("Cannot load time zone: `%s`", err)
+		}
+		d.location = location
+	}
+
+	if config["zones"] != nil {
+		zones := config["zones"].(map[string]interface{})
+		d.zones = make(map[string]*time.Location, len(zones))
+		for name, zone := range zones {
+			location, err := time.LoadLocation(zone.(string))
+			if err != nil {
+				return fmt.Errorf("Cannot load time zone `%s`: `%s`", name, err)
+			}
+			d.zones[name] = location
+		}
+	}
+
 	return nil
 }
 
 func init() {
-	registry.AddReceiver("Date", &Date{}, "")
+	registry.AddReceiver("Date", &Date{}, dateResponse{})
 }
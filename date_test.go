@@ -0,0 +1,125 @@
+// osop
+// Copyright (C) 2026 Karol 'Kenji Takahashi' Woźniak
+//
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+// OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var dateTestTime = time.Date(2026, time.January, 4, 7, 5, 9, 0, time.UTC)
+
+var FormatLayoutTests = []struct {
+	layout   string
+	locale   string
+	expected string
+}{
+	{"02/01/2006 15:04:05", "en", "04/01/2026 07:05:09"},
+	{"Monday, 2 January 2006", "en", "Sunday, 4 January 2026"},
+	{"Monday, 2 January 2006", "pl", "niedziela, 4 styczeń 2026"},
+	{"Mon Jan 2", "de", "So Jan 4"},
+	{"Jan2 Mon", "fr", "janv.4 dim."},
+	{"15:04 MST", "it", "07:05 UTC"},
+}
+
+func TestFormatLayout(t *testing.T) {
+	for _, tt := range FormatLayoutTests {
+		result := formatLayout(dateTestTime, tt.layout, dateLocales[tt.locale])
+		assert.Equal(t, tt.expected, result)
+	}
+}
+
+var FormatStrftimeTests = []struct {
+	format   string
+	locale   string
+	expected string
+}{
+	{"%d/%m/%Y %H:%M:%S", "en", "04/01/2026 07:05:09"},
+	{"%A, %e %B %y", "en", "Sunday,  4 January 26"},
+	{"%a %b %d", "es", "dom ene 04"},
+	{"%F %T %Z %z", "en", "2026-01-04 07:05:09 UTC +0000"},
+	{"%I%p %l%P %k", "en", "07AM  7am  7"},
+	{"%j %u %w %U %W %V %G %g", "en", "004 7 0 01 00 01 2026 26"},
+	{"%s %% %q %", "en", "1767510309 % %q %"},
+	{"%c", "nl", "zo jan  4 07:05:09 2026"},
+}
+
+func TestFormatStrftime(t *testing.T) {
+	for _, tt := range FormatStrftimeTests {
+		result := formatStrftime(dateTestTime, tt.format, dateLocales[tt.locale])
+		assert.Equal(t, tt.expected, result)
+	}
+}
+
+func TestDate(t *testing.T) {
+	date := &Date{}
+	assert.Nil(t, date.Init(config{
+		"strftime": "%A %H:%M",
+		"locale":   "pt_BR.UTF-8",
+		"zone":     "UTC",
+		"zones":    map[string]interface{}{"Tokyo": "Asia/Tokyo"},
+	}))
+
+	dt := date.getDateTime(dateTestTime)
+	assert.Equal(t, "domingo 07:05", dt.Formatted)
+	assert.Equal(t, int64(1767510309), dt.Unix)
+	assert.Equal(t, "domingo", dt.Weekday)
+	assert.Equal(t, "janeiro", dt.Month)
+	assert.Equal(t, 4, dt.YearDay)
+	assert.Equal(t, 2026, dt.ISOYear)
+	assert.Equal(t, 1, dt.ISOWeek)
+
+	value, err := date.Get()
+	assert.Nil(t, err)
+	var buf bytes.Buffer
+	tmpl := template.Must(template.New("t").Parse(
+		"{{.}} {{.Zone}} {{.Zones.Tokyo.Zone}}",
+	))
+	assert.Nil(t, tmpl.Execute(&buf, value))
+	assert.Regexp(t, `^\S+ \d\d:\d\d UTC JST$`, buf.String())
+
+	assert.NotNil(t, date.Init(config{}))
+	assert.NotNil(t, date.Init(config{"format": "", "zone": "Nowhere/Atlantis"}))
+}
+
+// Date sections used to be plain strings, so they have to keep
+// rendering the same through every string taking action.
+func TestDateTemplateActions(t *testing.T) {
+	date := &Date{}
+	assert.Nil(t, date.Init(config{"format": "02/01/2006 15:04:05"}))
+	value, err := date.Get()
+	assert.Nil(t, err)
+	formatted := value.(dateResponse).Formatted
+
+	marquee := &Marquee{separator: " | "}
+	tmpl := template.Must(template.New("t").Funcs(templateFuncs).Funcs(template.FuncMap{
+		"marquee": marquee.Scroll,
+	}).Parse("{{.Now}}|{{stringify .Now}}|{{marquee 20 .Now}}|{{marquee 5 .Now}}"))
+	var buf bytes.Buffer
+	assert.Nil(t, tmpl.Execute(&buf, map[string]interface{}{"Now": value}))
+	assert.Equal(t, formatted+"|"+formatted+"|"+formatted+"|"+formatted[:5], buf.String())
+	assert.True(t, marquee.scrolling)
+}
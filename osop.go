@@ -30,7 +30,10 @@ import (
 	"os"
 	"path"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
@@ -68,6 +71,39 @@ type EventedReceiver interface {
 	GetEvented() (interface{}, error)
 }
 
+// OptionallyEventedReceiver defines a receiver, which is able to act
+// as an EventedReceiver, but only under some circumstances (e.g. when
+// a system facility is available or it is enabled in config).
+//
+// Evented() is called once, before Worker starts. If it returns false,
+// receiver is treated as a PollingReceiver.
+type OptionallyEventedReceiver interface {
+	EventedReceiver
+	Evented() bool
+}
+
+// IntervalReceiver defines an evented receiver, which also refreshes
+// on its own every config:`pollInterval`, if no event comes.
+//
+// SetInterval() is called before every GetEvented() call with the interval
+// relevant for the current power state (see config:`pollIntervalOnBattery`).
+type IntervalReceiver interface {
+	EventedReceiver
+	SetInterval(interval time.Duration)
+}
+
+// DependentReceiver defines a receiver, which does not get its data
+// from the outside world, but computes it from other receivers' values.
+//
+// Dependencies() is called once, right after Init(), and should return
+// names of the sections it depends on. Compute() is then called with
+// the current data every time any of these sections change.
+type DependentReceiver interface {
+	PollingReceiver
+	Dependencies() []string
+	Compute(data map[string]interface{}) (interface{}, error)
+}
+
 // IRegistry defines interface for receivers registry.
 //
 // Default registry is provided as a globally accessible `registry`
@@ -131,15 +167,87 @@ type Change struct {
 	Value interface{}
 }
 
+// PowerMonitor keeps track of whether the machine is running on battery.
+type PowerMonitor struct {
+	mutex     sync.Mutex
+	onBattery bool
+	changed   chan struct{}
+}
+
+// State returns current power state and a channel,
+// which gets closed when the state changes.
+func (p *PowerMonitor) State() (bool, <-chan struct{}) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.onBattery, p.changed
+}
+
+func (p *PowerMonitor) set(onBattery bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if onBattery == p.onBattery {
+		return
+	}
+	p.onBattery = onBattery
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// Watch keeps power state up to date. Reacts to power supply uevents
+// if they are available, but also checks every `interval`, just in case.
+//
+// Machines without an AC adapter are never considered to be on battery.
+func (p *PowerMonitor) Watch(sysfs string, interval time.Duration) {
+	events, err := listenUevents()
+	if err != nil {
+		log.Printf("Cannot listen for power supply events: `%s`\n", err)
+	}
+	ticker := time.NewTicker(interval)
+	for {
+		online, err := acOnline(sysfs)
+		p.set(err == nil && !online)
+
+		for waiting := true; waiting; {
+			select {
+			case msg, ok := <-events:
+				if !ok {
+					events = nil
+					continue
+				}
+				waiting = parseUevent(msg)["SUBSYSTEM"] != "power_supply"
+			case <-ticker.C:
+				waiting = false
+			}
+		}
+	}
+}
+
+// power is a default, globally available PowerMonitor instance.
+// It is only watched when some section uses config:`pollIntervalOnBattery`.
+var power = &PowerMonitor{changed: make(chan struct{})}
+
+// pollMultiplierOnBattery is used to compute config:`pollIntervalOnBattery`
+// for sections which do not specify it. Zero means no change.
+var pollMultiplierOnBattery float64
+
 // Worker processes receiver value changes.
 //
 // Responsible for getting the value from receiver and propagating it
 // further to the template compilation method.
 type Worker struct {
-	pollInterval time.Duration
-	receiver     PollingReceiver
-	name         string
-	once         bool
+	pollInterval          time.Duration
+	pollIntervalOnBattery time.Duration
+	receiver              PollingReceiver
+	name                  string
+	once                  bool
+}
+
+// interval returns poll interval relevant for given power state.
+func (w *Worker) interval(onBattery bool) time.Duration {
+	if onBattery && w.pollIntervalOnBattery > 0 {
+		return w.pollIntervalOnBattery
+	}
+	return w.pollInterval
 }
 
 // doChange handles a single value change.
@@ -159,15 +267,28 @@ func (w *Worker) doChange(get func() (interface{}, error), ch chan Change) {
 
 // Do acts as a Worker event loop.
 //
-// For PollingReceivers, spawns every config:`pollInterval`.
-// For EventedReceivers, blocks until an event is generated.
+// For PollingReceivers, spawns every config:`pollInterval`
+// (or config:`pollIntervalOnBattery`, when running on battery).
+// For EventedReceivers, blocks until an event is generated
+// (IntervalReceivers also get their interval adjusted to power state).
+// For OptionallyEventedReceivers, depends on what Evented() says.
 func (w *Worker) Do(ch chan Change) {
-	switch r := w.receiver.(type) {
+	receiver := w.receiver
+	if r, ok := receiver.(OptionallyEventedReceiver); ok && !r.Evented() {
+		// Hide GetEvented, so it falls into polling case.
+		receiver = struct{ PollingReceiver }{r}
+	}
+
+	switch r := receiver.(type) {
 	case EventedReceiver:
 		// Get first value in "normal" manner,
 		// so user won't have to wait for an event to occur.
 		w.doChange(r.Get, ch)
 		for {
+			if r, ok := r.(IntervalReceiver); ok {
+				onBattery, _ := power.State()
+				r.SetInterval(w.interval(onBattery))
+			}
 			w.doChange(r.GetEvented, ch)
 			if w.once {
 				break
@@ -175,12 +296,23 @@ func (w *Worker) Do(ch chan Change) {
 		}
 	case PollingReceiver:
 		w.doChange(r.Get, ch)
-		for _ = range time.Tick(w.pollInterval) {
+		onBattery, changed := power.State()
+		ticker := time.NewTicker(w.interval(onBattery))
+		for {
+			select {
+			case <-changed:
+				onBattery, changed = power.State()
+				ticker.Stop()
+				ticker = time.NewTicker(w.interval(onBattery))
+				continue
+			case <-ticker.C:
+			}
 			w.doChange(r.Get, ch)
 			if w.once {
 				break
 			}
 		}
+		ticker.Stop()
 	}
 }
 
@@ -193,6 +325,13 @@ func NewWorker(name string, config config) *Worker {
 			interval = _interval
 		}
 	}
+	intervalOnBattery := time.Duration(float64(interval) * pollMultiplierOnBattery)
+	if config["pollIntervalOnBattery"] != nil {
+		_interval, err := time.ParseDuration(config["pollIntervalOnBattery"].(string))
+		if err == nil {
+			intervalOnBattery = _interval
+		}
+	}
 	receiver, _ := registry.GetReceiver(config["receiver"].(string))
 
 	err := receiver.Init(config)
@@ -203,9 +342,320 @@ func NewWorker(name string, config config) *Worker {
 	}
 
 	return &Worker{
-		pollInterval: interval,
-		receiver:     receiver,
-		name:         name,
+		pollInterval:          interval,
+		pollIntervalOnBattery: intervalOnBattery,
+		receiver:              receiver,
+		name:                  name,
+	}
+}
+
+// findCycle looks for a cycle in a dependency graph.
+// Returns names forming a cycle (with the first one repeated at the end)
+// or nil if the graph is acyclic.
+func findCycle(graph map[string][]string) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := make(map[string]int, len(graph))
+	var path []string
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch states[name] {
+		case visiting:
+			for i, n := range path {
+				if n == name {
+					return append(path[i:], name)
+				}
+			}
+		case visited:
+			return nil
+		}
+		states[name] = visiting
+		path = append(path, name)
+		for _, dependency := range graph[name] {
+			if cycle := visit(dependency); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		states[name] = visited
+		return nil
+	}
+
+	names := make([]string, 0, len(graph))
+	for name := range graph {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// toFloat converts any numeric (or numeric string) value to float64.
+func toFloat(arg interface{}) (float64, error) {
+	v := reflect.ValueOf(arg)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return strconv.ParseFloat(strings.TrimSpace(v.String()), 64)
+	}
+	return 0, fmt.Errorf("Cannot use `%v` as a number", arg)
+}
+
+// arithmetic wraps a binary float operation to be usable as a template function.
+func arithmetic(op func(a, b float64) float64) func(a, b interface{}) (float64, error) {
+	return func(a, b interface{}) (float64, error) {
+		x, err := toFloat(a)
+		if err != nil {
+			return 0, err
+		}
+		y, err := toFloat(b)
+		if err != nil {
+			return 0, err
+		}
+		return op(x, y), nil
+	}
+}
+
+// ByteFormat describes how byte values are turned into human readable form.
+type ByteFormat struct {
+	iec       bool
+	precision int
+	shorts    bool
+}
+
+// Format formats given number of bytes, e.g. "1.5MB" (SI), "1.5MiB" (IEC),
+// "1.5M" or "1.5Mi" (shorts).
+func (f ByteFormat) Format(n float64) string {
+	base, prefixes := 1000.0, []string{"k", "M", "G", "T", "P", "E"}
+	if f.iec {
+		base, prefixes = 1024.0, []string{"Ki", "Mi", "Gi", "Ti", "Pi", "Ei"}
+	}
+	// Unit is picked after rounding, so e.g. 1048575 bytes
+	// are "1.0MiB" and not "1024.0KiB".
+	i := -1
+	for i < len(prefixes)-1 {
+		precision := f.precision
+		if i < 0 {
+			precision = 0
+		}
+		rounded, _ := strconv.ParseFloat(strconv.FormatFloat(n, 'f', precision, 64), 64)
+		if rounded < base && rounded > -base {
+			break
+		}
+		n /= base
+		i += 1
+	}
+	if i < 0 {
+		return fmt.Sprintf("%.0fB", n)
+	}
+	unit := prefixes[i]
+	if !f.shorts {
+		unit += "B"
+	}
+	return strconv.FormatFloat(n, 'f', f.precision, 64) + unit
+}
+
+// Bytes formats any numeric value as a number of bytes.
+//
+// It is exposed as a `bytes` template function.
+func (f ByteFormat) Bytes(arg interface{}) (string, error) {
+	n, err := toFloat(arg)
+	if err != nil {
+		return "", err
+	}
+	return f.Format(n), nil
+}
+
+// Speed formats any numeric value as a number of bytes per second.
+//
+// It is exposed as a `speed` template function.
+func (f ByteFormat) Speed(arg interface{}) (string, error) {
+	b, err := f.Bytes(arg)
+	if err != nil {
+		return "", err
+	}
+	return b + "/s", nil
+}
+
+// NewByteFormat constructs new ByteFormat instance with given Osop config.
+func NewByteFormat(config map[string]interface{}) ByteFormat {
+	format := ByteFormat{iec: true, precision: 1}
+	if config["byteUnits"] != nil {
+		units := strings.ToLower(config["byteUnits"].(string))
+		if units != "si" && units != "iec" {
+			log.Printf("Unknown byte units `%s`, using `iec`\n", units)
+		} else {
+			format.iec = units == "iec"
+		}
+	}
+	if config["bytePrecision"] != nil {
+		format.precision = int(config["bytePrecision"].(int64))
+	}
+	if config["byteShorts"] != nil {
+		format.shorts = config["byteShorts"].(bool)
+	}
+	return format
+}
+
+// byteFormat is used by `bytes` and `speed` template functions.
+// It is configured from the Osop section at startup.
+var byteFormat = ByteFormat{iec: true, precision: 1}
+
+// textOf returns text of strings and values printing themselves
+// as strings (e.g. date sections). Other values give false.
+func textOf(arg interface{}) (string, bool) {
+	switch v := arg.(type) {
+	case string:
+		return v, true
+	case fmt.Stringer:
+		return v.String(), true
+	}
+	return "", false
+}
+
+// templateFuncs are available in all templates, i.e. in the Osop
+// section template and in the computed receivers.
+var templateFuncs = template.FuncMap{
+	"stringify": func(arg interface{}) string {
+		s, _ := textOf(arg)
+		return s
+	},
+	"add": arithmetic(func(a, b float64) float64 { return a + b }),
+	"sub": arithmetic(func(a, b float64) float64 { return a - b }),
+	"mul": arithmetic(func(a, b float64) float64 { return a * b }),
+	"div": arithmetic(func(a, b float64) float64 { return a / b }),
+	"bytes": func(arg interface{}) (string, error) {
+		return byteFormat.Bytes(arg)
+	},
+	"speed": func(arg interface{}) (string, error) {
+		return byteFormat.Speed(arg)
+	},
+	"now": time.Now,
+	"unix": func(arg interface{}) (time.Time, error) {
+		seconds, err := toFloat(arg)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(int64(seconds), 0), nil
+	},
+}
+
+// Marquee scrolls texts, which do not fit into a given width.
+//
+// Every tick moves all scrolled texts by one character, so they
+// need to be re-rendered even if no receiver value has changed.
+// Each text starts scrolling from its beginning when it first appears.
+type Marquee struct {
+	interval  time.Duration
+	separator string
+	frame     int
+	scrolling bool
+	ticker    *time.Ticker
+
+	// starts holds frames at which texts started scrolling.
+	// Only texts scrolled during the last render are kept.
+	starts map[string]int
+	used   map[string]bool
+}
+
+// Start prepares Marquee for a new render, forgetting texts
+// which were not scrolled during the previous one.
+func (m *Marquee) Start() {
+	for text := range m.starts {
+		if !m.used[text] {
+			delete(m.starts, text)
+		}
+	}
+	m.used = make(map[string]bool)
+	m.scrolling = false
+}
+
+// Scroll returns `width` characters long window of `arg` text,
+// moved by one character every `every` (defaults to 1) frames since
+// the text first appeared. Texts fitting into `width` are returned unchanged.
+//
+// It is exposed as a `marquee` template function.
+func (m *Marquee) Scroll(width int, arg interface{}, every ...int) string {
+	text, ok := textOf(arg)
+	if !ok {
+		text = fmt.Sprint(arg)
+	}
+	runes := []rune(text)
+	if width <= 0 || len(runes) <= width {
+		return text
+	}
+	m.scrolling = true
+
+	if m.starts == nil {
+		m.starts = make(map[string]int)
+	}
+	if m.used == nil {
+		m.used = make(map[string]bool)
+	}
+	start, ok := m.starts[text]
+	if !ok {
+		start = m.frame
+		m.starts[text] = start
+	}
+	m.used[text] = true
+	step := 1
+	if len(every) > 0 && every[0] > 1 {
+		step = every[0]
+	}
+
+	runes = append(runes, []rune(m.separator)...)
+	offset := (m.frame - start) / step % len(runes)
+	runes = append(runes[offset:], runes[:offset]...)
+	return string(runes[:width])
+}
+
+// Tick returns a channel which fires every config:`marqueeInterval`,
+// but only if something was scrolled during the last render.
+// Otherwise returns nil, which blocks forever.
+func (m *Marquee) Tick() <-chan time.Time {
+	if !m.scrolling {
+		if m.ticker != nil {
+			m.ticker.Stop()
+			m.ticker = nil
+		}
+		return nil
+	}
+	if m.ticker == nil {
+		m.ticker = time.NewTicker(m.interval)
+	}
+	return m.ticker.C
+}
+
+// NewMarquee constructs new Marquee instance with given Osop config.
+func NewMarquee(config map[string]interface{}) *Marquee {
+	interval := 500 * time.Millisecond
+	if config["marqueeInterval"] != nil {
+		_interval, err := time.ParseDuration(config["marqueeInterval"].(string))
+		if err == nil && _interval > 0 {
+			interval = _interval
+		}
+	}
+	separator := " | "
+	if config["marqueeSeparator"] != nil {
+		separator = config["marqueeSeparator"].(string)
+	}
+
+	return &Marquee{
+		interval:  interval,
+		separator: separator,
 	}
 }
 
@@ -245,15 +695,30 @@ template="<.Now>"
 	if !ok {
 		delims = []interface{}{"<", ">"}
 	}
+	byteFormat = NewByteFormat(configs["Osop"])
+	if multiplier, ok := configs["Osop"]["pollMultiplierOnBattery"]; ok {
+		switch m := multiplier.(type) {
+		case int64:
+			pollMultiplierOnBattery = float64(m)
+		case float64:
+			pollMultiplierOnBattery = m
+		}
+	}
+	watchPower := pollMultiplierOnBattery > 0
+	for _, conf := range configs {
+		if conf["pollIntervalOnBattery"] != nil {
+			watchPower = true
+		}
+	}
+	if watchPower {
+		go power.Watch("/sys", 10*time.Second)
+	}
+	marquee := NewMarquee(configs["Osop"])
 	t, err := template.New("t").Delims(
 		delims[0].(string), delims[1].(string),
-	).Funcs(template.FuncMap{"stringify": func(arg interface{}) string {
-		s, ok := arg.(string)
-		if !ok {
-			return ""
-		}
-		return s
-	}}).Parse(
+	).Funcs(templateFuncs).Funcs(template.FuncMap{
+		"marquee": marquee.Scroll,
+	}).Parse(
 		configs["Osop"]["template"].(string) + "\n",
 	)
 	fatal(err)
@@ -262,6 +727,8 @@ template="<.Now>"
 
 	data := make(map[string]interface{})
 
+	computed := make(map[string]DependentReceiver)
+	graph := make(map[string][]string)
 	for name, conf := range configs {
 		if name == "Osop" {
 			continue
@@ -272,11 +739,57 @@ template="<.Now>"
 			continue
 		}
 		data[name] = zero
+
+		receiver, _ := registry.GetReceiver(conf["receiver"].(string))
+		if dependent, ok := receiver.(DependentReceiver); ok {
+			if err := dependent.Init(conf); err != nil {
+				log.Printf("%s: Init error: %s\n", name, err)
+				continue
+			}
+			computed[name] = dependent
+			graph[name] = dependent.Dependencies()
+			continue
+		}
+
 		go func(ch chan *Worker, name string, conf config) {
 			ch <- NewWorker(name, conf)
 		}(workers, name, conf)
 	}
 
+	if cycle := findCycle(graph); cycle != nil {
+		fatal(fmt.Errorf("Dependency cycle found: `%s`", strings.Join(cycle, " -> ")))
+	}
+	dependents := make(map[string][]string)
+	for name, dependencies := range graph {
+		for _, dependency := range dependencies {
+			if _, ok := data[dependency]; !ok {
+				log.Printf("%s: Unknown dependency `%s`\n", name, dependency)
+			}
+			dependents[dependency] = append(dependents[dependency], name)
+		}
+	}
+
+	// update stores a new value and recomputes everything that depends on it.
+	var update func(name string, value interface{})
+	update = func(name string, value interface{}) {
+		data[name] = value
+		for _, dependent := range dependents[name] {
+			value, err := computed[dependent].Compute(data)
+			if err != nil {
+				log.Printf("%s: %s\n", dependent, err)
+				continue
+			}
+			update(dependent, value)
+		}
+	}
+	for name, dependencies := range graph {
+		if len(dependencies) == 0 {
+			if value, err := computed[name].Compute(data); err == nil {
+				update(name, value)
+			}
+		}
+	}
+
 	changes := make(chan Change)
 	var cache string
 	for {
@@ -285,21 +798,26 @@ template="<.Now>"
 			if worker != nil {
 				go worker.Do(changes)
 			}
+			continue
 		case change := <-changes:
-			data[change.Name] = change.Value
-			var buf bytes.Buffer
-			err := t.Execute(&buf, data)
-			if err != nil {
-				buf.WriteByte('\n')
-			}
+			update(change.Name, change.Value)
+		case <-marquee.Tick():
+			marquee.frame += 1
+		}
 
-			str := buf.String()
-			if str == cache {
-				continue
-			}
-			cache = str
+		marquee.Start()
+		var buf bytes.Buffer
+		err := t.Execute(&buf, data)
+		if err != nil {
+			buf.WriteByte('\n')
+		}
 
-			fmt.Print(cache)
+		str := buf.String()
+		if str == cache {
+			continue
 		}
+		cache = str
+
+		fmt.Print(cache)
 	}
 }
@@ -27,6 +27,7 @@ import (
 	"log"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -130,12 +131,32 @@ func (r *testReceiverEvented) GetEvented() (interface{}, error) {
 	return nil, fmt.Errorf("eventedError%d", r.Count)
 }
 
+type testReceiverOptionallyEvented struct {
+	testReceiverEvented
+	evented bool
+}
+
+func (r *testReceiverOptionallyEvented) Evented() bool {
+	return r.evented
+}
+
+type testReceiverInterval struct {
+	testReceiverEvented
+	intervals []time.Duration
+}
+
+func (r *testReceiverInterval) SetInterval(interval time.Duration) {
+	r.intervals = append(r.intervals, interval)
+}
+
 var WorkerTests = []struct {
 	receiver testReceiver
 	expected []string
 }{
 	{&testReceiverPolling{Good: true}, []string{"polling", "polling"}},
 	{&testReceiverEvented{testReceiverPolling{Good: true}}, []string{"polling", "evented"}},
+	{&testReceiverOptionallyEvented{testReceiverEvented{testReceiverPolling{Good: true}}, true}, []string{"polling", "evented"}},
+	{&testReceiverOptionallyEvented{testReceiverEvented{testReceiverPolling{Good: true}}, false}, []string{"polling", "polling"}},
 }
 
 func TestWorker(t *testing.T) {
@@ -208,6 +229,13 @@ var NewWorkerTests = []struct {
 	}},
 	{true, map[string]interface{}{"receiver": "test", "pollInterval": "1m"}, func(t *testing.T, worker *Worker) {
 		assert.Equal(t, time.Minute, worker.pollInterval)
+		assert.Equal(t, time.Duration(0), worker.pollIntervalOnBattery)
+	}},
+	{true, map[string]interface{}{"receiver": "test", "pollIntervalOnBattery": "1h"}, func(t *testing.T, worker *Worker) {
+		assert.Equal(t, time.Second, worker.pollInterval)
+		assert.Equal(t, time.Hour, worker.pollIntervalOnBattery)
+		assert.Equal(t, time.Second, worker.interval(false))
+		assert.Equal(t, time.Hour, worker.interval(true))
 	}},
 }
 
@@ -222,6 +250,243 @@ func TestNewWorker(t *testing.T) {
 
 		registry = correctRegistry
 	}
+
+	pollMultiplierOnBattery = 2.5
+	worker := NewWorker("test", map[string]interface{}{"receiver": "date", "format": ""})
+	assert.Equal(t, 2500*time.Millisecond, worker.pollIntervalOnBattery)
+	pollMultiplierOnBattery = 0
+}
+
+func TestPowerMonitor(t *testing.T) {
+	monitor := &PowerMonitor{changed: make(chan struct{})}
+	onBattery, changed := monitor.State()
+	assert.False(t, onBattery)
+
+	monitor.set(false)
+	select {
+	case <-changed:
+		t.Error("Channel closed without state change")
+	default:
+	}
+
+	monitor.set(true)
+	<-changed
+	onBattery, _ = monitor.State()
+	assert.True(t, onBattery)
+}
+
+func TestWorkerOnBattery(t *testing.T) {
+	correctPower := power
+	power = &PowerMonitor{changed: make(chan struct{})}
+
+	worker := Worker{
+		pollInterval:          time.Hour,
+		pollIntervalOnBattery: time.Millisecond,
+		receiver:              &testReceiverPolling{Good: true},
+		name:                  "test",
+		once:                  true,
+	}
+	ch := make(chan Change)
+	go worker.Do(ch)
+	assert.Equal(t, "pollingTest1", (<-ch).Value)
+
+	// Worker waits an hour, until it notices we are on battery.
+	power.set(true)
+	select {
+	case change := <-ch:
+		assert.Equal(t, "pollingTest2", change.Value)
+	case <-time.After(time.Second):
+		t.Error("Worker did not switch to on battery interval")
+	}
+
+	power = correctPower
+}
+
+func TestWorkerEventedOnBattery(t *testing.T) {
+	correctPower := power
+	power = &PowerMonitor{changed: make(chan struct{})}
+	defer func() { power = correctPower }()
+
+	receiver := &testReceiverInterval{}
+	receiver.Good = true
+	worker := Worker{
+		pollInterval:          time.Second,
+		pollIntervalOnBattery: time.Minute,
+		receiver:              receiver,
+		name:                  "test",
+		once:                  true,
+	}
+	// Each run sends the initial and the evented value.
+	ch := make(chan Change, 4)
+	worker.Do(ch)
+	power.set(true)
+	worker.Do(ch)
+	assert.Equal(t, []time.Duration{time.Second, time.Minute}, receiver.intervals)
+}
+
+var MarqueeTests = []struct {
+	width    int
+	text     string
+	every    []int
+	frame    int
+	expected string
+	scrolls  bool
+}{
+	{5, "short", nil, 0, "short", false},
+	{5, "shórt", nil, 3, "shórt", false},
+	{0, "anything", nil, 2, "anything", false},
+	{3, "abcdef", nil, 0, "abc", true},
+	{3, "abcdef", nil, 1, "bcd", true},
+	{3, "abcdef", nil, 4, "ef ", true},
+	{3, "abcdef", nil, 5, "f a", true},
+	{3, "abcdef", nil, 7, "abc", true},
+	{3, "ąęćś", nil, 2, "ćś ", true},
+	{3, "abcdef", []int{2}, 3, "bcd", true},
+	{3, "abcdef", []int{3}, 6, "cde", true},
+	{3, "abcdef", []int{0}, 1, "bcd", true},
+}
+
+func TestMarquee(t *testing.T) {
+	for i, tt := range MarqueeTests {
+		marquee := Marquee{
+			interval:  time.Millisecond,
+			separator: " ",
+			frame:     10,
+		}
+
+		// Text starts from its beginning, whatever the current frame is.
+		initial := tt.text
+		if tt.scrolls {
+			initial = string([]rune(tt.text)[:tt.width])
+		}
+		marquee.Start()
+		assert.Equal(t, initial, marquee.Scroll(tt.width, tt.text, tt.every...), "%d", i)
+
+		marquee.frame += tt.frame
+		marquee.Start()
+		assert.Equal(t, tt.expected, marquee.Scroll(tt.width, tt.text, tt.every...), "%d", i)
+		assert.Equal(t, tt.scrolls, marquee.scrolling, "%d", i)
+		assert.Equal(t, tt.scrolls, marquee.Tick() != nil, "%d", i)
+
+		marquee.scrolling = false
+		assert.Nil(t, marquee.Tick())
+		assert.Nil(t, marquee.ticker)
+	}
+}
+
+func TestMarqueeTextChange(t *testing.T) {
+	marquee := Marquee{separator: " "}
+	marquee.Start()
+	assert.Equal(t, "abc", marquee.Scroll(3, "abcdef"))
+	marquee.frame += 2
+	marquee.Start()
+	assert.Equal(t, "cde", marquee.Scroll(3, "abcdef"))
+	assert.Equal(t, "ghi", marquee.Scroll(3, "ghijkl"))
+
+	// Texts scroll independently and restart when they come back.
+	marquee.frame += 1
+	marquee.Start()
+	assert.Equal(t, "hij", marquee.Scroll(3, "ghijkl"))
+	marquee.Start()
+	assert.Equal(t, "abc", marquee.Scroll(3, "abcdef"))
+}
+
+func TestNewMarquee(t *testing.T) {
+	marquee := NewMarquee(map[string]interface{}{})
+	assert.Equal(t, 500*time.Millisecond, marquee.interval)
+	assert.Equal(t, " | ", marquee.separator)
+
+	marquee = NewMarquee(map[string]interface{}{
+		"marqueeInterval":  "1s",
+		"marqueeSeparator": "~",
+	})
+	assert.Equal(t, time.Second, marquee.interval)
+	assert.Equal(t, "~", marquee.separator)
+}
+
+var FindCycleTests = []struct {
+	graph    map[string][]string
+	expected []string
+}{
+	{map[string][]string{}, nil},
+	{map[string][]string{"a": {"b"}, "b": {"c"}}, nil},
+	{map[string][]string{"a": {"b", "c"}, "b": {"c"}, "c": {}}, nil},
+	{map[string][]string{"a": {"a"}}, []string{"a", "a"}},
+	{map[string][]string{"a": {"b"}, "b": {"a"}}, []string{"a", "b", "a"}},
+	{map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"b"}}, []string{"b", "c", "b"}},
+}
+
+func TestFindCycle(t *testing.T) {
+	for _, tt := range FindCycleTests {
+		assert.Equal(t, tt.expected, findCycle(tt.graph))
+	}
+}
+
+var ComputedTests = []struct {
+	config       config
+	dependencies []string
+	expected     interface{}
+}{
+	{config{"template": "static"}, []string{}, "static"},
+	{config{"template": "<.A> <$.B.X>"}, []string{"A", "B"}, "1 2"},
+	{config{"template": "<with .B><.X><end>"}, []string{"B"}, "2"},
+	{config{"template": "<range .C><.><end>"}, []string{"C"}, "34"},
+	{config{"template": "<add .A .B.X>", "number": true}, []string{"A", "B"}, float64(3)},
+	{config{"template": "[[sub .A 3]]", "delims": []interface{}{"[[", "]]"}}, []string{"A"}, "-2"},
+	{config{"template": `<index . "A"> <with .B><index $ "C" 0><end>`}, []string{"A", "B", "C"}, "1 3"},
+	{config{"template": `<range .C><index . 0><end>`}, []string{"C"}, "5152"},
+}
+
+func TestComputed(t *testing.T) {
+	data := map[string]interface{}{
+		"A": 1,
+		"B": struct{ X uint64 }{2},
+		"C": []string{"3", "4"},
+	}
+	for _, tt := range ComputedTests {
+		receiver := &Computed{}
+		assert.Nil(t, receiver.Init(tt.config))
+		assert.Equal(t, tt.dependencies, receiver.Dependencies())
+		value, err := receiver.Compute(data)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expected, value)
+	}
+}
+
+var ByteFormatTests = []struct {
+	config   map[string]interface{}
+	input    interface{}
+	expected string
+	speed    string
+}{
+	{map[string]interface{}{}, 512, "512B", "512B/s"},
+	{map[string]interface{}{}, uint64(1536), "1.5KiB", "1.5KiB/s"},
+	{map[string]interface{}{}, 1.5 * 1024 * 1024 * 1024, "1.5GiB", "1.5GiB/s"},
+	{map[string]interface{}{"byteUnits": "SI"}, int64(1500), "1.5kB", "1.5kB/s"},
+	{map[string]interface{}{"byteUnits": "si", "byteShorts": true}, "2500000", "2.5M", "2.5M/s"},
+	{map[string]interface{}{"byteShorts": true, "bytePrecision": int64(2)}, 1280, "1.25Ki", "1.25Ki/s"},
+	{map[string]interface{}{"byteUnits": "wrong", "bytePrecision": int64(0)}, 2048, "2KiB", "2KiB/s"},
+	{map[string]interface{}{}, 1048575, "1.0MiB", "1.0MiB/s"},
+	{map[string]interface{}{}, 1023.7, "1.0KiB", "1.0KiB/s"},
+	{map[string]interface{}{"byteUnits": "si", "bytePrecision": int64(2)}, -999999, "-1.00MB", "-1.00MB/s"},
+	{map[string]interface{}{"byteUnits": "si", "bytePrecision": int64(0)}, 1499, "1kB", "1kB/s"},
+}
+
+func TestByteFormat(t *testing.T) {
+	for _, tt := range ByteFormatTests {
+		format := NewByteFormat(tt.config)
+
+		result, err := format.Bytes(tt.input)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expected, result)
+		result, err = format.Speed(tt.input)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.speed, result)
+	}
+	logR.Reset()
+
+	_, err := byteFormat.Bytes(struct{}{})
+	assert.Equal(t, "Cannot use `{}` as a number", err.Error())
 }
 
 // Basic routine for checking that all receivers are registered.
@@ -231,8 +496,10 @@ func TestReceivers(t *testing.T) {
 		if file == "osop.go" || (len(file) > 7 && file[len(file)-7:len(file)] == "test.go") {
 			continue
 		}
+		// Platform specific parts, e.g. `battery_linux.go`.
+		name := strings.SplitN(file[0:len(file)-3], "_", 2)[0]
 
-		receiver, err := registry.GetReceiver(file[0 : len(file)-3])
+		receiver, err := registry.GetReceiver(name)
 		assert.Nil(t, err)
 		assert.NotNil(t, receiver)
 	}
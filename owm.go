@@ -25,27 +25,102 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"time"
 )
 
-const URL = "http://api.openweathermap.org/data/2.5/weather"
+const (
+	BaseURL = "http://api.openweathermap.org/data/2.5"
+	// Hourly forecast is only available from the pro server.
+	HourlyBaseURL = "https://pro.openweathermap.org/data/2.5"
+)
 
 type Owm struct {
-	url string
+	url    string
+	client *http.Client
+
+	// After being rate limited, requests are held back until retryAt.
+	retryAt time.Time
+	backoff time.Duration
+
+	icons map[string][2]string
+
+	forecastURL      string
+	forecastInterval time.Duration
+	forecastUpdated  time.Time
+	forecast         []owmForecast
+	timezone         int64
+}
+
+// owmError is an error payload returned by OpenWeatherMap.
+// Cod is a number or a string, depending on endpoint.
+type owmError struct {
+	Cod     interface{}
+	Message string
+}
+
+type owmCondition struct {
+	ID          int
+	Main        string
+	Description string
+	// Icon is OpenWeatherMap icon code, e.g. "10d".
+	Icon string
+}
+
+// owmPrecipitation is a volume of rain or snow, in mm.
+type owmPrecipitation struct {
+	OneHour    float64 `json:"1h"`
+	ThreeHours float64 `json:"3h"`
+}
+
+// owmData is decoded from parts common to all weather endpoints.
+type owmData struct {
+	Dt   int64
+	Main struct {
+		Temp       float64
+		Feels_like float64
+		Pressure   int
+		Humidity   int
+		Temp_min   float64
+		Temp_max   float64
+	}
+	Weather []owmCondition
+	Clouds  struct {
+		All int
+	}
+	Wind struct {
+		Speed float64
+		Deg   int
+	}
+	Visibility int
+	Rain       owmPrecipitation
+	Snow       owmPrecipitation
 }
 
 type owmResponse struct {
-	City     string
-	Country  string
-	Sunrise  uint64
-	Sunset   uint64
-	Temp     float64
-	TempMin  float64
-	TempMax  float64
-	Pressure int
-	Humidity int
+	City       string
+	Country    string
+	Sunrise    uint64
+	Sunset     uint64
+	Day        bool
+	Temp       float64
+	FeelsLike  float64
+	TempMin    float64
+	TempMax    float64
+	Pressure   int
+	Humidity   int
+	Clouds     int
+	Visibility int
+	Rain       owmPrecipitation
+	Snow       owmPrecipitation
+
+	Condition  owmCondition
+	Conditions []owmCondition
+	Glyph      string
 
 	Wind struct {
 		Speed float64
@@ -56,16 +131,222 @@ type owmResponse struct {
 		Lon float64
 		Lat float64
 	}
+
+	Forecast []owmForecast
+	// NextPrecipitation is zero if there is none in the forecast.
+	NextPrecipitation   uint64
+	NextPrecipitationIn time.Duration
+	TodayHigh           float64
+	TodayLow            float64
 }
 
-func (o *Owm) Get() (interface{}, error) {
-	resp, err := http.Get(o.url)
+type owmForecast struct {
+	Time      uint64
+	Day       bool
+	Temp      float64
+	FeelsLike float64
+	TempMin   float64
+	TempMax   float64
+	Humidity  int
+	Clouds    int
+	// Pop is a probability of precipitation, from 0 to 1.
+	Pop       float64
+	Rain      owmPrecipitation
+	Snow      owmPrecipitation
+	Condition owmCondition
+	Glyph     string
+}
+
+// precipitating tells whether rain or snow is expected.
+func (f owmForecast) precipitating() bool {
+	switch f.Condition.ID / 100 {
+	case 2, 3, 5, 6:
+		return true
+	}
+	return f.Rain.OneHour+f.Rain.ThreeHours+f.Snow.OneHour+f.Snow.ThreeHours > 0
+}
+
+// owmDefaultIcons maps condition ids, or their groups (e.g. "8xx"),
+// to day and night glyphs.
+var owmDefaultIcons = map[string][2]string{
+	"2xx": {"⛈", "⛈"},
+	"3xx": {"🌦", "🌧"},
+	"5xx": {"🌧", "🌧"},
+	"511": {"🌨", "🌨"},
+	"6xx": {"🌨", "🌨"},
+	"7xx": {"🌫", "🌫"},
+	"800": {"☀", "🌙"},
+	"801": {"🌤", "☁"},
+	"802": {"⛅", "☁"},
+	"8xx": {"☁", "☁"},
+}
+
+// glyph finds glyph for condition id, looking for the exact id first
+// and its group next, in configured icons and then in defaults.
+func (o *Owm) glyph(id int, day bool) string {
+	keys := []string{strconv.Itoa(id), fmt.Sprintf("%dxx", id/100)}
+	for _, icons := range []map[string][2]string{o.icons, owmDefaultIcons} {
+		for _, key := range keys {
+			if icon, ok := icons[key]; ok {
+				if day {
+					return icon[0]
+				}
+				return icon[1]
+			}
+		}
+	}
+	return ""
+}
+
+// parseIcons parses config:`icons` table, with either a single glyph
+// or a [day, night] pair for each condition id or group.
+func parseIcons(config map[string]interface{}) (map[string][2]string, error) {
+	icons := make(map[string][2]string)
+	for key, value := range config {
+		switch value := value.(type) {
+		case string:
+			icons[key] = [2]string{value, value}
+		case []interface{}:
+			if len(value) != 2 {
+				return nil, fmt.Errorf("Icon `%s` must be a [day, night] pair", key)
+			}
+			icons[key] = [2]string{fmt.Sprint(value[0]), fmt.Sprint(value[1])}
+		default:
+			return nil, fmt.Errorf("Icon `%s` must be a string or a [day, night] pair", key)
+		}
+	}
+	return icons, nil
+}
+
+// rateLimited holds back requests for the time server asked for in
+// Retry-After header or, if there is none, for exponentially longer time.
+func (o *Owm) rateLimited(retryAfter string) {
+	o.backoff *= 2
+	if o.backoff < time.Minute {
+		o.backoff = time.Minute
+	}
+	if o.backoff > time.Hour {
+		o.backoff = time.Hour
+	}
+	delay := o.backoff
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds > 0 {
+		delay = time.Duration(seconds) * time.Second
+	}
+	o.retryAt = time.Now().Add(delay)
+}
+
+// fetch gets given url and decodes JSON response into value.
+func (o *Owm) fetch(url string, value interface{}) error {
+	resp, err := o.client.Get(url)
 	if err != nil {
-		return nil, fmt.Errorf("Cannot get response: `%s`", err)
+		return fmt.Errorf("Cannot get response: `%s`", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusTooManyRequests {
+			o.rateLimited(resp.Header.Get("Retry-After"))
+		}
+		var payload owmError
+		err := json.NewDecoder(resp.Body).Decode(&payload)
+		if err == nil && payload.Message != "" {
+			return fmt.Errorf("API error `%v`: `%s`", payload.Cod, payload.Message)
+		}
+		return fmt.Errorf("Unexpected response: `%s`", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(value); err != nil {
+		return fmt.Errorf("Cannot decode response: `%s`", err)
+	}
+	o.backoff = 0
+	return nil
+}
+
+// getForecast fetches forecast entries and city timezone offset.
+func (o *Owm) getForecast() ([]owmForecast, int64, error) {
+	var decoded struct {
+		owmError
+		List []struct {
+			owmData
+			Pop float64
+			Sys struct {
+				Pod string
+			}
+		}
+		City struct {
+			Timezone int64
+		}
+	}
+	if err := o.fetch(o.forecastURL, &decoded); err != nil {
+		return nil, 0, err
+	}
+	if decoded.Cod != nil && fmt.Sprint(decoded.Cod) != "200" {
+		return nil, 0, fmt.Errorf("API error `%v`: `%s`", decoded.Cod, decoded.Message)
+	}
+
+	forecast := make([]owmForecast, len(decoded.List))
+	for i, entry := range decoded.List {
+		forecast[i] = owmForecast{
+			Time:      uint64(entry.Dt),
+			Day:       entry.Sys.Pod == "d",
+			Temp:      entry.Main.Temp,
+			FeelsLike: entry.Main.Feels_like,
+			TempMin:   entry.Main.Temp_min,
+			TempMax:   entry.Main.Temp_max,
+			Humidity:  entry.Main.Humidity,
+			Clouds:    entry.Clouds.All,
+			Pop:       entry.Pop,
+			Rain:      entry.Rain,
+			Snow:      entry.Snow,
+		}
+		if len(entry.Weather) > 0 {
+			forecast[i].Condition = entry.Weather[0]
+			forecast[i].Glyph = o.glyph(entry.Weather[0].ID, forecast[i].Day)
+		}
+	}
+	return forecast, decoded.City.Timezone, nil
+}
+
+// summarize fills forecast summaries, relative to given time.
+// Entries already over are skipped, today is determined in city's timezone.
+func (r *owmResponse) summarize(forecast []owmForecast, timezone int64, now time.Time) {
+	step := uint64(3 * time.Hour / time.Second)
+	if len(forecast) > 1 && forecast[1].Time > forecast[0].Time {
+		step = forecast[1].Time - forecast[0].Time
+	}
+	zone := time.FixedZone("", int(timezone))
+	year, month, day := now.In(zone).Date()
+
+	r.Forecast = make([]owmForecast, 0, len(forecast))
+	r.TodayHigh, r.TodayLow = r.Temp, r.Temp
+	for _, entry := range forecast {
+		if entry.Time+step <= uint64(now.Unix()) {
+			continue
+		}
+		r.Forecast = append(r.Forecast, entry)
+
+		if r.NextPrecipitation == 0 && entry.precipitating() {
+			r.NextPrecipitation = entry.Time
+			if start := time.Unix(int64(entry.Time), 0); start.After(now) {
+				r.NextPrecipitationIn = start.Sub(now)
+			}
+		}
+		y, m, d := time.Unix(int64(entry.Time), 0).In(zone).Date()
+		if y == year && m == month && d == day {
+			r.TodayHigh = math.Max(r.TodayHigh, entry.TempMax)
+			r.TodayLow = math.Min(r.TodayLow, entry.TempMin)
+		}
+	}
+}
+
+func (o *Owm) Get() (interface{}, error) {
+	if time.Now().Before(o.retryAt) {
+		// Rate limited, keep the last value.
+		return nil, nil
+	}
+
 	var decoded struct {
+		owmError
+		owmData
 		Coord struct {
 			Lon float64
 			Lat float64
@@ -75,62 +356,107 @@ func (o *Owm) Get() (interface{}, error) {
 			Sunrise uint64
 			Sunset  uint64
 		}
-		Main struct {
-			Temp     float64
-			Pressure int
-			Humidity int
-			Temp_min float64
-			Temp_max float64
-		}
-		Wind struct {
-			Speed float64
-			Deg   int
-		}
 		Name string
 	}
-	json.NewDecoder(resp.Body).Decode(&decoded)
+	if err := o.fetch(o.url, &decoded); err != nil {
+		return nil, err
+	}
+	// Some errors are reported with 200 status code.
+	if decoded.Cod != nil && fmt.Sprint(decoded.Cod) != "200" {
+		return nil, fmt.Errorf("API error `%v`: `%s`", decoded.Cod, decoded.Message)
+	}
+
+	now := decoded.Dt
+	if now == 0 {
+		now = time.Now().Unix()
+	}
+	resp := owmResponse{
+		City:       decoded.Name,
+		Country:    decoded.Sys.Country,
+		Sunrise:    decoded.Sys.Sunrise,
+		Sunset:     decoded.Sys.Sunset,
+		Day:        now >= int64(decoded.Sys.Sunrise) && now < int64(decoded.Sys.Sunset),
+		Temp:       decoded.Main.Temp,
+		FeelsLike:  decoded.Main.Feels_like,
+		TempMin:    decoded.Main.Temp_min,
+		TempMax:    decoded.Main.Temp_max,
+		Pressure:   decoded.Main.Pressure,
+		Humidity:   decoded.Main.Humidity,
+		Clouds:     decoded.Clouds.All,
+		Visibility: decoded.Visibility,
+		Rain:       decoded.Rain,
+		Snow:       decoded.Snow,
+		Conditions: decoded.Weather,
+		Wind:       decoded.Wind,
+		Coord:      decoded.Coord,
+	}
+	if len(decoded.Weather) > 0 {
+		resp.Condition = decoded.Weather[0]
+		resp.Glyph = o.glyph(resp.Condition.ID, resp.Day)
+	}
+
+	if o.forecastURL != "" && time.Since(o.forecastUpdated) >= o.forecastInterval {
+		forecast, timezone, err := o.getForecast()
+		if err != nil {
+			// Current weather is fine, so keep on with older forecast.
+			log.Printf("Owm: Cannot get forecast: %s\n", err)
+		} else {
+			o.forecast, o.timezone = forecast, timezone
+			o.forecastUpdated = time.Now()
+		}
+	}
+	if o.forecastURL != "" {
+		resp.summarize(o.forecast, o.timezone, time.Now())
+	}
+	return resp, nil
+}
 
-	return owmResponse{
-		City:     decoded.Name,
-		Country:  decoded.Sys.Country,
-		Sunrise:  decoded.Sys.Sunrise,
-		Sunset:   decoded.Sys.Sunset,
-		Temp:     decoded.Main.Temp,
-		TempMin:  decoded.Main.Temp_min,
-		TempMax:  decoded.Main.Temp_max,
-		Pressure: decoded.Main.Pressure,
-		Humidity: decoded.Main.Humidity,
-		Wind:     decoded.Wind,
-		Coord:    decoded.Coord,
-	}, nil
+// owmURL builds endpoint URL with given query.
+func owmURL(base string, endpoint string, query url.Values) (string, error) {
+	_url, err := url.Parse(strings.TrimSuffix(base, "/") + "/" + endpoint)
+	if err != nil {
+		return "", fmt.Errorf("Cannot parse URL: `%s`", err)
+	}
+	_url.RawQuery = query.Encode()
+	return _url.String(), nil
 }
 
 func (o *Owm) Init(config config) error {
-	if config["location"] == nil {
-		return fmt.Errorf("`location` parameter is required")
-	}
 	if config["apiKey"] == nil {
 		return fmt.Errorf("`apiKey` parameter is required")
 	}
 
-	_url, err := url.Parse(URL)
-	if err != nil {
-		return fmt.Errorf("Cannot parse URL: `%s`", err)
-	}
-	location := config["location"].(string)
-	_, err = strconv.Atoi(location)
 	urlQuery := url.Values{}
-	if err != nil {
-		urlQuery.Add("q", location)
-	} else {
-		urlQuery.Add("id", location)
+	switch {
+	case config["location"] != nil:
+		location := config["location"].(string)
+		if _, err := strconv.Atoi(location); err != nil {
+			urlQuery.Add("q", location)
+		} else {
+			urlQuery.Add("id", location)
+		}
+	case config["lat"] != nil && config["lon"] != nil:
+		lat, err := toFloat(config["lat"])
+		if err != nil {
+			return fmt.Errorf("Wrong `lat`: %s", err)
+		}
+		lon, err := toFloat(config["lon"])
+		if err != nil {
+			return fmt.Errorf("Wrong `lon`: %s", err)
+		}
+		urlQuery.Add("lat", strconv.FormatFloat(lat, 'f', -1, 64))
+		urlQuery.Add("lon", strconv.FormatFloat(lon, 'f', -1, 64))
+	case config["zip"] != nil:
+		urlQuery.Add("zip", fmt.Sprint(config["zip"]))
+	default:
+		return fmt.Errorf("One of `location`, `lat` and `lon` or `zip` parameters is required")
 	}
 	urlQuery.Add("APPID", config["apiKey"].(string))
 
 	units := "metric"
 	if config["units"] != nil {
 		_units := config["units"].(string)
-		if _units != "metric" && _units != "imperial" {
+		if _units != "metric" && _units != "imperial" && _units != "standard" {
 			log.Printf("Unknown units `%s`, using `metric`\n", _units)
 		} else {
 			units = _units
@@ -138,9 +464,65 @@ func (o *Owm) Init(config config) error {
 	}
 	urlQuery.Add("units", units)
 
-	_url.RawQuery = urlQuery.Encode()
+	if config["lang"] != nil {
+		urlQuery.Add("lang", config["lang"].(string))
+	}
+
+	base, hourlyBase := BaseURL, HourlyBaseURL
+	if config["baseURL"] != nil {
+		base = config["baseURL"].(string)
+		hourlyBase = base
+	}
+	var err error
+	if o.url, err = owmURL(base, "weather", urlQuery); err != nil {
+		return err
+	}
+
+	o.forecastURL = ""
+	if config["forecast"] != nil {
+		switch forecast := config["forecast"].(string); forecast {
+		case "3h":
+			o.forecastURL, err = owmURL(base, "forecast", urlQuery)
+		case "hourly":
+			o.forecastURL, err = owmURL(hourlyBase, "forecast/hourly", urlQuery)
+		default:
+			return fmt.Errorf("Unknown forecast `%s`, use `3h` or `hourly`", forecast)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	o.forecastInterval = time.Hour
+	if config["forecastInterval"] != nil {
+		o.forecastInterval, err = time.ParseDuration(config["forecastInterval"].(string))
+		if err != nil {
+			return fmt.Errorf("Cannot parse forecastInterval: `%s`", err)
+		}
+	}
+	o.forecastUpdated = time.Time{}
+	o.forecast = nil
+
+	timeout := 10 * time.Second
+	if config["timeout"] != nil {
+		timeout, err = time.ParseDuration(config["timeout"].(string))
+		if err != nil {
+			return fmt.Errorf("Cannot parse timeout: `%s`", err)
+		}
+	}
+	o.client = &http.Client{Timeout: timeout}
 
-	o.url = _url.String()
+	o.icons = nil
+	if config["icons"] != nil {
+		icons, ok := config["icons"].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("`icons` must be a table")
+		}
+		if o.icons, err = parseIcons(icons); err != nil {
+			return err
+		}
+	}
+	o.retryAt = time.Time{}
+	o.backoff = 0
 	return nil
 }
 
@@ -0,0 +1,344 @@
+// osop
+// Copyright (C) 2026 Karol 'Kenji Takahashi' Woźniak
+//
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+// OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var owmTestWeather = `{
+	"coord": {"lon": -0.13, "lat": 51.51},
+	"weather": [
+		{"id": 501, "main": "Rain", "description": "moderate rain", "icon": "10n"},
+		{"id": 701, "main": "Mist", "description": "mist", "icon": "50n"}
+	],
+	"main": {"temp": 12.5, "feels_like": 11.8, "pressure": 1012, "humidity": 81, "temp_min": 11, "temp_max": 14},
+	"visibility": 8000,
+	"wind": {"speed": 4.1, "deg": 80},
+	"clouds": {"all": 90},
+	"rain": {"1h": 1.25},
+	"dt": 1760045000,
+	"sys": {"country": "GB", "sunrise": 1760000000, "sunset": 1760040000},
+	"name": "London",
+	"cod": 200
+}`
+
+// newTestOwm creates Owm talking to a fake server, which responds
+// with given status, headers and body. Returned counter tells
+// how many requests were made.
+func newTestOwm(t *testing.T, status int, headers map[string]string, body string) (*Owm, *int, func()) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests += 1
+		for key, value := range headers {
+			w.Header().Set(key, value)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+
+	o := &Owm{}
+	assert.Nil(t, o.Init(config{"location": "London,UK", "apiKey": "key", "baseURL": server.URL}))
+	return o, &requests, server.Close
+}
+
+func TestOwm(t *testing.T) {
+	o, _, cleanup := newTestOwm(t, http.StatusOK, nil, owmTestWeather)
+	defer cleanup()
+
+	value, err := o.Get()
+	assert.Nil(t, err)
+	resp := value.(owmResponse)
+	assert.Equal(t, "London", resp.City)
+	assert.Equal(t, "GB", resp.Country)
+	assert.Equal(t, 12.5, resp.Temp)
+	assert.Equal(t, 11.0, resp.TempMin)
+	assert.Equal(t, 81, resp.Humidity)
+	assert.Equal(t, 4.1, resp.Wind.Speed)
+	assert.Equal(t, 51.51, resp.Coord.Lat)
+	assert.Equal(t, 11.8, resp.FeelsLike)
+	assert.Equal(t, 90, resp.Clouds)
+	assert.Equal(t, 8000, resp.Visibility)
+	assert.Equal(t, owmPrecipitation{OneHour: 1.25}, resp.Rain)
+	assert.Equal(t, owmPrecipitation{}, resp.Snow)
+	assert.False(t, resp.Day)
+	assert.Equal(t, owmCondition{ID: 501, Main: "Rain", Description: "moderate rain", Icon: "10n"}, resp.Condition)
+	assert.Len(t, resp.Conditions, 2)
+	assert.Equal(t, "🌧", resp.Glyph)
+}
+
+var OwmGlyphTests = []struct {
+	id       int
+	day      bool
+	expected string
+}{
+	{800, true, "D"},
+	{800, false, "N"},
+	{801, true, "cloud"},
+	{802, true, "⛅"},
+	{802, false, "☁"},
+	{804, true, "☁"},
+	{511, true, "🌨"},
+	{500, false, "🌧"},
+	{900, true, ""},
+}
+
+func TestOwmGlyph(t *testing.T) {
+	o := &Owm{}
+	assert.Nil(t, o.Init(config{"location": "London,UK", "apiKey": "key", "icons": map[string]interface{}{
+		"800": []interface{}{"D", "N"},
+		"801": "cloud",
+	}}))
+	for i, tt := range OwmGlyphTests {
+		assert.Equal(t, tt.expected, o.glyph(tt.id, tt.day), "%d", i)
+	}
+
+	assert.NotNil(t, o.Init(config{"location": "London,UK", "apiKey": "key", "icons": map[string]interface{}{
+		"800": []interface{}{"D"},
+	}}))
+	assert.NotNil(t, o.Init(config{"location": "London,UK", "apiKey": "key", "icons": map[string]interface{}{
+		"800": int64(1),
+	}}))
+}
+
+var OwmErrorsTests = []struct {
+	status   int
+	body     string
+	expected string
+}{
+	{http.StatusUnauthorized, `{"cod": 401, "message": "Invalid API key."}`, "API error `401`: `Invalid API key.`"},
+	{http.StatusNotFound, `{"cod": "404", "message": "city not found"}`, "API error `404`: `city not found`"},
+	{http.StatusBadGateway, `<html>Bad Gateway</html>`, "Unexpected response: `502 Bad Gateway`"},
+	{http.StatusOK, `{"cod": "404", "message": "city not found"}`, "API error `404`: `city not found`"},
+	{http.StatusOK, `{"name": "London"`, "Cannot decode response: `unexpected EOF`"},
+}
+
+func TestOwmErrors(t *testing.T) {
+	for i, tt := range OwmErrorsTests {
+		o, requests, cleanup := newTestOwm(t, tt.status, nil, tt.body)
+
+		value, err := o.Get()
+		assert.Nil(t, value, "%d", i)
+		if assert.NotNil(t, err, "%d", i) {
+			assert.Equal(t, tt.expected, err.Error(), "%d", i)
+		}
+		// Only rate limiting holds requests back.
+		o.Get()
+		assert.Equal(t, 2, *requests, "%d", i)
+
+		cleanup()
+	}
+}
+
+func TestOwmTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	o := &Owm{}
+	assert.Nil(t, o.Init(config{"location": "London,UK", "apiKey": "key", "timeout": "50ms", "baseURL": server.URL}))
+
+	_, err := o.Get()
+	assert.NotNil(t, err)
+	assert.NotNil(t, o.Init(config{"location": "London,UK", "apiKey": "key", "timeout": "soon"}))
+}
+
+func TestOwmRateLimit(t *testing.T) {
+	o, requests, cleanup := newTestOwm(t, http.StatusTooManyRequests,
+		map[string]string{"Retry-After": "120"},
+		`{"cod": 429, "message": "Your account is temporary blocked"}`)
+	defer cleanup()
+
+	_, err := o.Get()
+	assert.NotNil(t, err)
+	assert.WithinDuration(t, time.Now().Add(120*time.Second), o.retryAt, 5*time.Second)
+
+	// Last value is kept, without asking server again.
+	value, err := o.Get()
+	assert.Nil(t, value)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, *requests)
+
+	// Without Retry-After, backoff grows exponentially, up to an hour.
+	o.retryAt = time.Time{}
+	o.rateLimited("")
+	assert.Equal(t, 2*time.Minute, o.backoff)
+	for i := 0; i < 10; i++ {
+		o.rateLimited("")
+	}
+	assert.Equal(t, time.Hour, o.backoff)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), o.retryAt, 5*time.Second)
+}
+
+var owmTestForecast = `{
+	"cod": "200",
+	"cnt": 5,
+	"list": [
+		{"dt": 1760020000, "main": {"temp": 20, "temp_min": 20, "temp_max": 25}, "weather": [{"id": 800}], "sys": {"pod": "d"}},
+		{"dt": 1760040000, "main": {"temp": 13, "temp_min": 10, "temp_max": 15}, "weather": [{"id": 800}], "sys": {"pod": "n"}},
+		{"dt": 1760050800, "main": {"temp": 11, "temp_min": 9, "temp_max": 13}, "weather": [{"id": 804}], "sys": {"pod": "n"}},
+		{"dt": 1760061600, "main": {"temp": 9, "temp_min": 8, "temp_max": 10, "humidity": 90},
+		 "weather": [{"id": 500, "main": "Rain", "description": "light rain", "icon": "10n"}],
+		 "clouds": {"all": 100}, "pop": 0.8, "rain": {"3h": 0.5}, "sys": {"pod": "n"}},
+		{"dt": 1760072400, "main": {"temp": 8, "temp_min": 7, "temp_max": 9}, "weather": [{"id": 501}], "sys": {"pod": "n"}}
+	],
+	"city": {"name": "London", "timezone": 3600}
+}`
+
+func TestOwmForecast(t *testing.T) {
+	requests := map[string]int{}
+	forecastStatus := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path] += 1
+		if r.URL.Path == "/forecast" {
+			w.WriteHeader(forecastStatus)
+			w.Write([]byte(owmTestForecast))
+			return
+		}
+		w.Write([]byte(owmTestWeather))
+	}))
+	defer server.Close()
+
+	o := &Owm{}
+	assert.Nil(t, o.Init(config{
+		"location": "London,UK", "apiKey": "key", "forecast": "3h", "baseURL": server.URL + "/",
+	}))
+
+	_, err := o.Get()
+	assert.Nil(t, err)
+	assert.Len(t, o.forecast, 5)
+	assert.Equal(t, int64(3600), o.timezone)
+	assert.Equal(t, owmForecast{
+		Time:      1760061600,
+		Temp:      9,
+		TempMin:   8,
+		TempMax:   10,
+		Humidity:  90,
+		Clouds:    100,
+		Pop:       0.8,
+		Rain:      owmPrecipitation{ThreeHours: 0.5},
+		Condition: owmCondition{ID: 500, Main: "Rain", Description: "light rain", Icon: "10n"},
+		Glyph:     "🌧",
+	}, o.forecast[3])
+
+	// Forecast has its own refresh interval.
+	_, err = o.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, requests["/weather"])
+	assert.Equal(t, 1, requests["/forecast"])
+
+	// Failing forecast does not affect current weather.
+	o.forecastUpdated = time.Time{}
+	forecastStatus = http.StatusInternalServerError
+	value, err := o.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, "London", value.(owmResponse).City)
+	assert.Len(t, o.forecast, 5)
+
+	assert.NotNil(t, o.Init(config{"location": "London,UK", "apiKey": "key", "forecast": "daily"}))
+	assert.NotNil(t, o.Init(config{"location": "London,UK", "apiKey": "key", "forecastInterval": "often"}))
+	assert.Nil(t, o.Init(config{"location": "London,UK", "apiKey": "key", "forecast": "hourly"}))
+	assert.Contains(t, o.forecastURL, HourlyBaseURL+"/forecast/hourly?")
+	assert.Nil(t, o.Init(config{"location": "London,UK", "apiKey": "key", "forecast": "hourly", "baseURL": server.URL}))
+	assert.Contains(t, o.forecastURL, server.URL+"/forecast/hourly?")
+}
+
+var OwmQueryTests = []struct {
+	config   config
+	expected url.Values
+}{
+	{config{"location": "London,UK"}, url.Values{"q": {"London,UK"}, "units": {"metric"}}},
+	{config{"location": "2643743", "units": "imperial"}, url.Values{"id": {"2643743"}, "units": {"imperial"}}},
+	{config{"lat": 51.51, "lon": int64(-1), "units": "standard"}, url.Values{
+		"lat": {"51.51"}, "lon": {"-1"}, "units": {"standard"},
+	}},
+	{config{"zip": "94040,us", "lang": "de", "units": "kelvin"}, url.Values{
+		"zip": {"94040,us"}, "lang": {"de"}, "units": {"metric"},
+	}},
+	{config{"lat": 51.51}, nil},
+	{config{"lat": "north", "lon": 0.0}, nil},
+	{config{}, nil},
+}
+
+func TestOwmQuery(t *testing.T) {
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/data/weather", r.URL.Path)
+		query = r.URL.Query()
+		w.Write([]byte(owmTestWeather))
+	}))
+	defer server.Close()
+
+	for i, tt := range OwmQueryTests {
+		tt.config["apiKey"] = "key"
+		tt.config["baseURL"] = server.URL + "/data"
+
+		o := &Owm{}
+		err := o.Init(tt.config)
+		if tt.expected == nil {
+			assert.NotNil(t, err, "%d", i)
+			continue
+		}
+		assert.Nil(t, err, "%d", i)
+
+		_, err = o.Get()
+		assert.Nil(t, err, "%d", i)
+		tt.expected["APPID"] = []string{"key"}
+		assert.Equal(t, tt.expected, query, "%d", i)
+	}
+}
+
+func TestOwmForecastSummary(t *testing.T) {
+	forecast := []owmForecast{
+		{Time: 1760020000, TempMin: 20, TempMax: 25, Condition: owmCondition{ID: 500}},
+		{Time: 1760040000, TempMin: 10, TempMax: 15, Condition: owmCondition{ID: 800}},
+		{Time: 1760050800, TempMin: 9, TempMax: 13, Condition: owmCondition{ID: 804}},
+		{Time: 1760061600, TempMin: 8, TempMax: 10, Condition: owmCondition{ID: 500}},
+		{Time: 1760072400, TempMin: 7, TempMax: 9, Snow: owmPrecipitation{ThreeHours: 1}},
+	}
+
+	// 22:23 local time, the first entry is already over.
+	resp := owmResponse{Temp: 12.5}
+	resp.summarize(forecast, 3600, time.Unix(1760045000, 0))
+	assert.Len(t, resp.Forecast, 4)
+	assert.Equal(t, uint64(1760061600), resp.NextPrecipitation)
+	assert.Equal(t, 16600*time.Second, resp.NextPrecipitationIn)
+	assert.Equal(t, 15.0, resp.TodayHigh)
+	assert.Equal(t, 10.0, resp.TodayLow)
+
+	// Precipitation in the ongoing entry.
+	resp = owmResponse{Temp: 12.5}
+	resp.summarize(forecast[3:], 3600, time.Unix(1760062000, 0))
+	assert.Equal(t, uint64(1760061600), resp.NextPrecipitation)
+	assert.Equal(t, time.Duration(0), resp.NextPrecipitationIn)
+
+	resp = owmResponse{Temp: 12.5}
+	resp.summarize(forecast[1:3], 3600, time.Unix(1760045000, 0))
+	assert.Equal(t, uint64(0), resp.NextPrecipitation)
+}
@@ -22,13 +22,26 @@
 package main
 
 import (
+	"bufio"
+	"encoding/binary"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
+	"unsafe"
 
 	"github.com/pyk/byten"
 	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/disk"
 	"github.com/shirou/gopsutil/host"
 	"github.com/shirou/gopsutil/mem"
 	"github.com/shirou/gopsutil/net"
@@ -49,12 +62,78 @@ func bytonizeUint(i uint64, speed, short bool) string {
 }
 
 type Sys struct {
-	metrics []string
+	metrics []sysMetric
 	shorts  bool
 
-	downloaded map[string]uint64
-	uploaded   map[string]uint64
-	interval   float64
+	cpuTimes  map[string][]uint64
+	cpuTotal  uint64
+	procTicks map[int]sysProcessTicks
+
+	procfs   string
+	sysfs    string
+	cgroupfs string
+
+	interval time.Duration
+	pressure chan struct{}
+}
+
+// sysPoll is state shared by all metrics gathered during a single poll.
+type sysPoll struct {
+	now time.Time
+	// Processes can only be read once per poll for CPU usage to make sense.
+	processes []sysResponseProcess
+}
+
+// sysCollector gathers a single, already validated metric into response.
+type sysCollector func(resp *sysResponse, poll *sysPoll) error
+
+// sysMetric is a single configured metric, refreshed at its own interval.
+type sysMetric struct {
+	name     string
+	metric   string
+	collect  sysCollector
+	interval time.Duration
+	updated  time.Time
+	cached   sysResponse
+}
+
+// rateSample is a single counter value, sampled at given time.
+type rateSample struct {
+	value uint64
+	time  time.Time
+}
+
+// rates computes per second rates of monotonically increasing counters,
+// using time actually elapsed between samples, keyed by counter name.
+//
+// Every metric keeps its own rates, as metrics covering the same counter
+// are sampled at the same time and would see no time elapsed otherwise.
+type rates map[string]rateSample
+
+// rate records new value of counter and returns its per second change
+// since the previous sample. Reports false if there is no previous sample,
+// no time has elapsed, or the counter has been reset.
+func (r rates) rate(key string, value uint64, now time.Time) (float64, bool) {
+	prev, ok := r[key]
+	r[key] = rateSample{value, now}
+	if !ok {
+		return 0, false
+	}
+	elapsed := now.Sub(prev.time).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+
+	delta := value - prev.value
+	if value < prev.value {
+		// 32 bit counters close to their limit most likely wrapped around,
+		// anything else has been reset (e.g. interface was recreated).
+		if prev.value > math.MaxUint32 || prev.value < math.MaxUint32/2 {
+			return 0, false
+		}
+		delta = value + (math.MaxUint32 - prev.value) + 1
+	}
+	return float64(delta) / elapsed, true
 }
 
 type sysResponseNetwork struct {
@@ -62,134 +141,1763 @@ type sysResponseNetwork struct {
 	Recv     string
 	Download string
 	Upload   string
+
+	SentBytes     uint64
+	RecvBytes     uint64
+	DownloadBytes float64
+	UploadBytes   float64
+
+	State     string
+	MAC       string
+	IPv4      []string
+	IPv6      []string
+	MTU       int
+	ErrorsIn  uint64
+	ErrorsOut uint64
+	DropsIn   uint64
+	DropsOut  uint64
+}
+
+type sysResponseDisk struct {
+	Total string
+	Used  string
+	Free  string
+
+	TotalBytes    uint64
+	UsedBytes     uint64
+	FreeBytes     uint64
+	Percent       float64
+	InodesTotal   uint64
+	InodesUsed    uint64
+	InodesFree    uint64
+	InodesPercent float64
+}
+
+type sysResponseDiskIO struct {
+	Read  string
+	Write string
+
+	ReadBytes  float64
+	WriteBytes float64
+	ReadIOPS   float64
+	WriteIOPS  float64
+	Busy       float64
+}
+
+type sysResponseWifi struct {
+	SSID      string
+	BSSID     string
+	Quality   float64
+	Signal    float64
+	Bitrate   float64
+	Frequency float64
+}
+
+type sysResponseProcess struct {
+	PID      int
+	Name     string
+	CPU      float64
+	RSS      string
+	RSSBytes uint64
+}
+
+// sysProcessTicks keeps CPU time used by process so far.
+type sysProcessTicks struct {
+	ticks uint64
+	// Start time tells apart processes with reused PIDs.
+	start uint64
+}
+
+type sysResponseUptime struct {
+	Duration time.Duration
+	Days     int
+	Hours    int
+	Minutes  int
+	Idle     time.Duration
+}
+
+func (u sysResponseUptime) String() string {
+	if u.Days > 0 {
+		return fmt.Sprintf("%dd %dh %dm", u.Days, u.Hours, u.Minutes)
+	}
+	return fmt.Sprintf("%dh %dm", u.Hours, u.Minutes)
+}
+
+type sysResponseCgroup struct {
+	Path    string
+	Version int
+	Memory  struct {
+		Used  string
+		Limit string
+
+		UsedBytes  uint64
+		LimitBytes uint64
+		Percent    float64
+	}
+	CPU struct {
+		Usage   float64
+		Quota   float64
+		Percent float64
+	}
+	Pids struct {
+		Current uint64
+		Limit   uint64
+	}
+}
+
+type sysResponsePressureStall struct {
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	Total  time.Duration
+}
+
+type sysResponsePressure struct {
+	Some sysResponsePressureStall
+	Full sysResponsePressureStall
+}
+
+type sysResponseCPUFreq struct {
+	Current float64
+	Min     float64
+	Max     float64
+}
+
+type sysResponseCPUTimes struct {
+	User    float64
+	Nice    float64
+	System  float64
+	Idle    float64
+	Iowait  float64
+	Irq     float64
+	Softirq float64
+	Steal   float64
+}
+
+type sysResponseTemp struct {
+	Current  float64
+	High     float64
+	Critical float64
+}
+
+type sysResponseFan struct {
+	RPM float64
+	Min float64
+	Max float64
 }
 
 type sysResponse struct {
 	CPU struct {
 		Percent map[string]float64
+		Freq    map[string]sysResponseCPUFreq
+		Times   map[string]sysResponseCPUTimes
+	}
+	Load struct {
+		Load1  float64
+		Load5  float64
+		Load15 float64
+	}
+	Procs struct {
+		Total   uint64
+		Running uint64
+		Blocked uint64
+		Zombie  uint64
 	}
-	Uptime uint64
-	Memory struct {
+	BootTime uint64
+	Uptime   sysResponseUptime
+	Users    int
+	Cgroup   map[string]sysResponseCgroup
+	Pressure map[string]sysResponsePressure
+	Memory   struct {
 		Total string
 		UsedF string
 		UsedA string
+
+		TotalBytes uint64
+		UsedFBytes uint64
+		UsedABytes uint64
+		Percent    float64
 	}
 	Swap struct {
 		Total string
 		Used  string
+
+		TotalBytes uint64
+		UsedBytes  uint64
+		Percent    float64
 	}
 	Network map[string]sysResponseNetwork
+	Disk    map[string]sysResponseDisk
+	DiskIO  map[string]sysResponseDiskIO
+	Temp    map[string]map[string]sysResponseTemp
+	Fan     map[string]map[string]sysResponseFan
+	Wifi    map[string]sysResponseWifi
+	Top     map[string][]sysResponseProcess
 }
 
 func (s *Sys) Get() (interface{}, error) {
 	resp := sysResponse{}
-	var err error
-	for _, metric := range s.metrics {
-		split := strings.Split(strings.ToLower(metric), " ")
-		switch split[0] {
-		case "cpu":
-			if len(split) < 2 {
-				err = fmt.Errorf("Sys: `cpu` requires argument")
-			}
-			switch split[1] {
-			case "percent":
-				var cpupercents []float64
-				if len(split) < 3 || split[2] == "false" {
-					cpupercents, err = cpu.Percent(0, false)
-				} else if split[2] == "true" {
-					cpupercents, err = cpu.Percent(0, true)
-				} else {
-					err = fmt.Errorf("Sys: `cpu percent` got wrong argument")
-					break
+	poll := &sysPoll{now: time.Now()}
+	for i := range s.metrics {
+		metric := &s.metrics[i]
+		// Allow some slack, so that polling jitter does not skip whole intervals.
+		if !metric.updated.IsZero() && poll.now.Sub(metric.updated) < metric.interval-metric.interval/10 {
+			mergeSysResponse(&resp, &metric.cached)
+			continue
+		}
+		metric.updated = poll.now
+		metric.cached = sysResponse{}
+		err := metric.collect(&metric.cached, poll)
+		if err != nil {
+			log.Printf("Sys: Cannot get `%s`: `%s`\n", metric.metric, err)
+		}
+		mergeSysResponse(&resp, &metric.cached)
+	}
+
+	return resp, nil
+}
+
+// parseMetric validates metric arguments and returns its collector.
+func (s *Sys) parseMetric(name string, args []string) (sysCollector, error) {
+	simple := func(get func(*sysResponse) error) (sysCollector, error) {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("`%s` takes no arguments", name)
+		}
+		return func(resp *sysResponse, _ *sysPoll) error { return get(resp) }, nil
+	}
+	requireArgs := func() error {
+		if len(args) == 0 {
+			return fmt.Errorf("`%s` requires argument", name)
+		}
+		return nil
+	}
+
+	switch strings.ToLower(name) {
+	case "cpu":
+		if err := requireArgs(); err != nil {
+			return nil, err
+		}
+		switch sub := strings.ToLower(args[0]); sub {
+		case "percent", "times":
+			percpu := false
+			if len(args) > 2 {
+				return nil, fmt.Errorf("`cpu %s` takes at most one argument", sub)
+			}
+			if len(args) == 2 {
+				var err error
+				if percpu, err = strconv.ParseBool(args[1]); err != nil {
+					return nil, fmt.Errorf("`cpu %s` got wrong argument `%s`", sub, args[1])
+				}
+			}
+			if sub == "times" {
+				return func(resp *sysResponse, _ *sysPoll) (err error) {
+					resp.CPU.Times, err = s.getCPUTimes(percpu)
+					return
+				}, nil
+			}
+			return func(resp *sysResponse, _ *sysPoll) error {
+				return s.getCPUPercent(resp, percpu)
+			}, nil
+		case "freq":
+			args = args[1:]
+			return simple(func(resp *sysResponse) (err error) {
+				resp.CPU.Freq, err = s.getCPUFreq()
+				return
+			})
+		}
+		return nil, fmt.Errorf("`cpu` got wrong argument `%s`", args[0])
+	case "load":
+		return simple(s.getLoad)
+	case "procs":
+		return simple(s.getProcs)
+	case "uptime":
+		return simple(s.getUptime)
+	case "cgroup":
+		paths := args
+		if len(paths) == 0 {
+			paths = []string{""}
+		}
+		samples := make(rates)
+		return func(resp *sysResponse, poll *sysPoll) (err error) {
+			resp.Cgroup = make(map[string]sysResponseCgroup)
+			for _, path := range paths {
+				name := path
+				if name == "" {
+					name = "self"
+				}
+				cgroup, _err := s.getCgroup(samples, path, poll.now)
+				if _err != nil {
+					err = _err
+				}
+				resp.Cgroup[name] = cgroup
+			}
+			return
+		}, nil
+	case "pressure":
+		resources := args
+		if len(resources) == 0 {
+			resources = []string{"cpu", "memory", "io"}
+		}
+		for i, resource := range resources {
+			resources[i] = strings.ToLower(resource)
+			if !sysPressureResources[resources[i]] {
+				return nil, fmt.Errorf("`pressure` got wrong resource `%s`", resource)
+			}
+		}
+		return func(resp *sysResponse, _ *sysPoll) (err error) {
+			resp.Pressure = make(map[string]sysResponsePressure)
+			for _, resource := range resources {
+				pressure, _err := s.getPressure(resource)
+				if _err != nil {
+					err = _err
 				}
-				resp.CPU.Percent = make(map[string]float64)
-				for i, cpupercent := range cpupercents {
-					resp.CPU.Percent[fmt.Sprintf("cpu%d", i)] = cpupercent
+				resp.Pressure[resource] = pressure
+			}
+			return
+		}, nil
+	case "users":
+		return simple(func(resp *sysResponse) error {
+			users, err := host.Users()
+			resp.Users = len(users)
+			return err
+		})
+	case "memory":
+		return simple(s.getMemory)
+	case "swap":
+		return simple(s.getSwap)
+	case "temp":
+		// Sensors are matched case insensitively.
+		patterns := make([]string, len(args))
+		for i, arg := range args {
+			patterns[i] = strings.ToLower(arg)
+		}
+		return func(resp *sysResponse, _ *sysPoll) error {
+			return s.getSensors(resp, patterns)
+		}, nil
+	case "top":
+		if err := requireArgs(); err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("`top` requires positive number, got `%s`", args[0])
+		}
+		by, patterns := "cpu", args[1:]
+		if len(patterns) > 0 {
+			if order := strings.ToLower(patterns[0]); order == "cpu" || order == "mem" {
+				by, patterns = order, patterns[1:]
+			}
+		}
+		return func(resp *sysResponse, poll *sysPoll) error {
+			if poll.processes == nil {
+				processes, err := s.readProcesses()
+				if err != nil {
+					return err
+				}
+				poll.processes = processes
+			}
+			if resp.Top == nil {
+				resp.Top = make(map[string][]sysResponseProcess)
+			}
+			resp.Top[by] = topProcesses(poll.processes, n, by, patterns)
+			return nil
+		}, nil
+	case "network":
+		samples := make(rates)
+		return func(resp *sysResponse, poll *sysPoll) error {
+			counters, err := net.IOCounters(true)
+			if err != nil {
+				return err
+			}
+			interfaces, err := net.Interfaces()
+			if err != nil {
+				return err
+			}
+			resp.Network = s.getNetwork(samples, counters, interfaces, args, poll.now)
+			return nil
+		}, nil
+	case "disk":
+		if err := requireArgs(); err != nil {
+			return nil, err
+		}
+		return func(resp *sysResponse, _ *sysPoll) error {
+			return s.getDisk(resp, args)
+		}, nil
+	case "diskio":
+		if err := requireArgs(); err != nil {
+			return nil, err
+		}
+		samples := make(rates)
+		return func(resp *sysResponse, poll *sysPoll) error {
+			counters, err := disk.IOCounters()
+			if err != nil {
+				return err
+			}
+			resp.DiskIO, err = s.getDiskIOs(samples, counters, args, poll.now)
+			return err
+		}, nil
+	case "wifi":
+		if err := requireArgs(); err != nil {
+			return nil, err
+		}
+		return func(resp *sysResponse, _ *sysPoll) (err error) {
+			resp.Wifi = make(map[string]sysResponseWifi)
+			for _, iface := range args {
+				wifi, _err := s.getWifi(iface)
+				if _err != nil {
+					err = _err
 				}
+				resp.Wifi[iface] = wifi
+			}
+			return
+		}, nil
+	}
+	return nil, fmt.Errorf("Unknown metric `%s`", name)
+}
+
+// parseMetrics parses metrics in either string (e.g. "disk / /home")
+// or table (e.g. {metric="disk", args=["/", "/home"], interval="60s"}) form.
+// Invalid metrics are logged and skipped.
+func (s *Sys) parseMetrics(metrics []interface{}) []sysMetric {
+	parsed := make([]sysMetric, 0, len(metrics))
+	aggregated := false
+	for _, metric := range metrics {
+		var m sysMetric
+		var args []string
+		switch metric := metric.(type) {
+		case string:
+			m.metric = metric
+		case map[string]interface{}:
+			m.metric, _ = metric["metric"].(string)
+			if m.metric == "" {
+				log.Printf("Sys: Metric table requires `metric` string: `%v`\n", metric)
+				continue
+			}
+			if metric["args"] != nil {
+				values, ok := metric["args"].([]interface{})
+				if !ok {
+					log.Printf("Sys: `%s` args must be a list\n", m.metric)
+					continue
+				}
+				for _, value := range values {
+					args = append(args, fmt.Sprint(value))
+				}
+			}
+			if metric["interval"] != nil {
+				interval, err := time.ParseDuration(fmt.Sprint(metric["interval"]))
+				if err != nil {
+					log.Printf("Sys: Cannot parse `%s` interval: `%s`\n", m.metric, err)
+					continue
+				}
+				m.interval = interval
+			}
+		default:
+			log.Printf("Sys: Metric must be a string or a table, got `%v`\n", metric)
+			continue
+		}
+
+		fields := strings.Fields(m.metric)
+		if len(fields) == 0 {
+			log.Printf("Sys: Empty metric\n")
+			continue
+		}
+		args = append(append([]string{}, fields[1:]...), args...)
+		m.metric = strings.TrimSpace(fields[0] + " " + strings.Join(args, " "))
+
+		var err error
+		m.name = strings.ToLower(fields[0])
+		if m.collect, err = s.parseMetric(fields[0], args); err != nil {
+			log.Printf("Sys: Invalid metric `%s`: %s\n", m.metric, err)
+			continue
+		}
+		// Network aggregate is always reported as `all`,
+		// so there can be only one.
+		if m.name == "network" && len(args) > 0 && strings.ToLower(args[0]) == "all" {
+			if aggregated {
+				log.Printf("Sys: Invalid metric `%s`: only one `network all` metric is allowed\n", m.metric)
+				continue
 			}
-		case "uptime":
-			resp.Uptime, err = host.BootTime()
-		case "memory":
-			var m *mem.VirtualMemoryStat
-			m, err = mem.VirtualMemory()
-			resp.Memory.Total = bytonizeUint(m.Total, false, s.shorts)
-			resp.Memory.UsedF = bytonizeUint(m.Used, false, s.shorts)
-			resp.Memory.UsedA = bytonizeUint(m.Total-m.Available, false, s.shorts)
-		case "swap":
-			var m *mem.SwapMemoryStat
-			m, err = mem.SwapMemory()
-			resp.Swap.Total = bytonizeUint(m.Total, false, s.shorts)
-			resp.Swap.Used = bytonizeUint(m.Used, false, s.shorts)
-		case "network":
-			var nic []net.IOCountersStat
-			if len(split) < 2 || strings.ToLower(split[1]) == "all" {
-				// FIXME: Returns eth0 only, seems gopsutil bug
-				//nic, err = gopsutil.NetIOCounters(false)
-				//if err != nil || len(nic) == 0 {
-				//break
-				//}
-				//resp.Network = map[string]gopsutil.NetIOCountersStat{"All": nic[0]}
-			} else {
-				nic, err = net.IOCounters(true)
-				if err != nil || len(nic) == 0 {
-					break
+			aggregated = true
+		}
+		parsed = append(parsed, m)
+	}
+	return parsed
+}
+
+func (s *Sys) getCPUPercent(resp *sysResponse, percpu bool) error {
+	cpupercents, err := cpu.Percent(0, percpu)
+	if err != nil {
+		return err
+	}
+	resp.CPU.Percent = make(map[string]float64)
+	for i, cpupercent := range cpupercents {
+		resp.CPU.Percent[fmt.Sprintf("cpu%d", i)] = cpupercent
+	}
+	return nil
+}
+
+func (s *Sys) getLoad(resp *sysResponse) error {
+	loadavg, err := ioutil.ReadFile(filepath.Join(s.procfs, "loadavg"))
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(loadavg))
+	if len(fields) < 3 {
+		return fmt.Errorf("Sys: wrong loadavg format")
+	}
+	resp.Load.Load1, _ = strconv.ParseFloat(fields[0], 64)
+	resp.Load.Load5, _ = strconv.ParseFloat(fields[1], 64)
+	resp.Load.Load15, _ = strconv.ParseFloat(fields[2], 64)
+	return nil
+}
+
+// getUptime reads uptime and idle time from `/proc/uptime`
+// and boot time from `/proc/stat`.
+func (s *Sys) getUptime(resp *sysResponse) error {
+	data, err := ioutil.ReadFile(filepath.Join(s.procfs, "uptime"))
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return fmt.Errorf("Sys: wrong uptime format")
+	}
+	uptime, _ := strconv.ParseFloat(fields[0], 64)
+	idle, _ := strconv.ParseFloat(fields[1], 64)
+
+	duration := time.Duration(uptime * float64(time.Second))
+	resp.Uptime = sysResponseUptime{
+		Duration: duration,
+		Days:     int(duration / (24 * time.Hour)),
+		Hours:    int(duration/time.Hour) % 24,
+		Minutes:  int(duration/time.Minute) % 60,
+		Idle:     time.Duration(idle * float64(time.Second)),
+	}
+
+	lines, err := s.readProcStat("btime")
+	if err != nil {
+		return err
+	}
+	if len(lines) == 0 || len(lines[0]) < 2 {
+		return fmt.Errorf("Sys: boot time not found")
+	}
+	resp.BootTime, err = strconv.ParseUint(lines[0][1], 10, 64)
+	return err
+}
+
+// readCgroupSelf reads cgroup paths of the current process from
+// `/proc/self/cgroup`, keyed by controller ("" for cgroup v2).
+func (s *Sys) readCgroupSelf() map[string]string {
+	paths := make(map[string]string)
+	data, err := ioutil.ReadFile(filepath.Join(s.procfs, "self", "cgroup"))
+	if err != nil {
+		return paths
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) < 3 {
+			continue
+		}
+		for _, controller := range strings.Split(fields[1], ",") {
+			paths[controller] = fields[2]
+		}
+	}
+	return paths
+}
+
+// cgroupDir finds directory of cgroup at given path for given controller.
+// For cgroup v2, all controllers live in the same hierarchy.
+func (s *Sys) cgroupDir(version int, path string, self map[string]string, controller string) string {
+	root := s.cgroupfs
+	if version == 1 {
+		// Controllers can be mounted together, e.g. as `cpu,cpuacct`.
+		mounts, _ := filepath.Glob(filepath.Join(s.cgroupfs, "*"))
+		for _, mount := range mounts {
+			for _, name := range strings.Split(filepath.Base(mount), ",") {
+				if name == controller {
+					root = mount
 				}
-				resp.Network = make(map[string]sysResponseNetwork)
-				for _, iface := range split[1:] {
-					resp.Network[iface] = s.getNetworkByName(nic, iface)
+			}
+		}
+		if root == s.cgroupfs {
+			return ""
+		}
+	} else {
+		controller = ""
+	}
+
+	if path == "" {
+		path = self[controller]
+	}
+	dir := filepath.Join(root, path)
+	if _, err := os.Stat(dir); err != nil {
+		// Inside containers, own cgroup is usually mounted as the root,
+		// while still being reported with the host path.
+		return root
+	}
+	return dir
+}
+
+// readCgroupValue reads a single number from cgroup file.
+// Reports zero for unlimited values.
+func readCgroupValue(path string) (uint64, bool) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	value := strings.Fields(string(data))
+	if len(value) == 0 {
+		return 0, false
+	}
+	if value[0] == "max" || value[0] == "-1" {
+		return 0, true
+	}
+	number, err := strconv.ParseUint(value[0], 10, 64)
+	// Cgroup v1 uses page aligned maximum int64 for unlimited.
+	if number >= 1<<62 {
+		number = 0
+	}
+	return number, err == nil
+}
+
+// readCgroupKey reads value with given key from cgroup file
+// in `key value` per line format.
+func readCgroupKey(path string, key string) (uint64, bool) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == key {
+			value, err := strconv.ParseUint(fields[1], 10, 64)
+			return value, err == nil
+		}
+	}
+	return 0, false
+}
+
+// getCgroup reads resource usage of cgroup at given path,
+// or of the current process' cgroup if path is empty.
+func (s *Sys) getCgroup(samples rates, path string, now time.Time) (sysResponseCgroup, error) {
+	cgroup := sysResponseCgroup{Version: 1}
+	if _, err := os.Stat(filepath.Join(s.cgroupfs, "cgroup.controllers")); err == nil {
+		cgroup.Version = 2
+	}
+	self := s.readCgroupSelf()
+	found := false
+
+	var used, limit, inactive uint64
+	var okUsed bool
+	memory := s.cgroupDir(cgroup.Version, path, self, "memory")
+	if cgroup.Version == 2 {
+		cgroup.Path = memory
+		used, okUsed = readCgroupValue(filepath.Join(memory, "memory.current"))
+		limit, _ = readCgroupValue(filepath.Join(memory, "memory.max"))
+		inactive, _ = readCgroupKey(filepath.Join(memory, "memory.stat"), "inactive_file")
+	} else if memory != "" {
+		cgroup.Path = memory
+		used, okUsed = readCgroupValue(filepath.Join(memory, "memory.usage_in_bytes"))
+		limit, _ = readCgroupValue(filepath.Join(memory, "memory.limit_in_bytes"))
+		inactive, _ = readCgroupKey(filepath.Join(memory, "memory.stat"), "total_inactive_file")
+	}
+	if okUsed {
+		found = true
+		// Page cache can be reclaimed, so it is not counted as used.
+		if inactive < used {
+			used -= inactive
+		}
+		cgroup.Memory.UsedBytes = used
+		cgroup.Memory.LimitBytes = limit
+		cgroup.Memory.Used = bytonizeUint(used, false, s.shorts)
+		if limit > 0 {
+			cgroup.Memory.Limit = bytonizeUint(limit, false, s.shorts)
+			cgroup.Memory.Percent = float64(used) / float64(limit) * 100
+		}
+	}
+
+	// CPU usage is tracked in microseconds.
+	var usage, quota, period uint64
+	var okUsage bool
+	if cgroup.Version == 2 {
+		dir := s.cgroupDir(cgroup.Version, path, self, "cpu")
+		usage, okUsage = readCgroupKey(filepath.Join(dir, "cpu.stat"), "usage_usec")
+		if data, err := ioutil.ReadFile(filepath.Join(dir, "cpu.max")); err == nil {
+			if fields := strings.Fields(string(data)); len(fields) == 2 {
+				quota, _ = strconv.ParseUint(fields[0], 10, 64)
+				period, _ = strconv.ParseUint(fields[1], 10, 64)
+			}
+		}
+	} else {
+		if dir := s.cgroupDir(cgroup.Version, path, self, "cpuacct"); dir != "" {
+			usage, okUsage = readCgroupValue(filepath.Join(dir, "cpuacct.usage"))
+			usage /= 1000
+		}
+		if dir := s.cgroupDir(cgroup.Version, path, self, "cpu"); dir != "" {
+			quota, _ = readCgroupValue(filepath.Join(dir, "cpu.cfs_quota_us"))
+			period, _ = readCgroupValue(filepath.Join(dir, "cpu.cfs_period_us"))
+		}
+	}
+	if okUsage {
+		found = true
+		if quota > 0 && period > 0 {
+			cgroup.CPU.Quota = float64(quota) / float64(period)
+		}
+		rate, ok := samples.rate("cgroup/"+path+"/usage", usage, now)
+		if ok {
+			cgroup.CPU.Usage = rate / 1e6
+			cores := cgroup.CPU.Quota
+			if cores == 0 {
+				cores = float64(runtime.NumCPU())
+			}
+			cgroup.CPU.Percent = cgroup.CPU.Usage / cores * 100
+		}
+	}
+
+	if dir := s.cgroupDir(cgroup.Version, path, self, "pids"); dir != "" {
+		var ok bool
+		if cgroup.Pids.Current, ok = readCgroupValue(filepath.Join(dir, "pids.current")); ok {
+			found = true
+			cgroup.Pids.Limit, _ = readCgroupValue(filepath.Join(dir, "pids.max"))
+		}
+	}
+
+	if !found {
+		return cgroup, fmt.Errorf("Sys: cgroup `%s` not found", path)
+	}
+	return cgroup, nil
+}
+
+var sysPressureResources = map[string]bool{
+	"cpu": true, "memory": true, "io": true, "irq": true,
+}
+
+// getPressure reads pressure stall information from `/proc/pressure`.
+func (s *Sys) getPressure(resource string) (sysResponsePressure, error) {
+	pressure := sysResponsePressure{}
+	data, err := ioutil.ReadFile(filepath.Join(s.procfs, "pressure", resource))
+	if err != nil {
+		return pressure, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		stall := sysResponsePressureStall{}
+		for _, field := range fields[1:] {
+			split := strings.SplitN(field, "=", 2)
+			if len(split) != 2 {
+				continue
+			}
+			value, _ := strconv.ParseFloat(split[1], 64)
+			switch split[0] {
+			case "avg10":
+				stall.Avg10 = value
+			case "avg60":
+				stall.Avg60 = value
+			case "avg300":
+				stall.Avg300 = value
+			case "total":
+				stall.Total = time.Duration(value) * time.Microsecond
+			}
+		}
+		switch fields[0] {
+		case "some":
+			pressure.Some = stall
+		case "full":
+			pressure.Full = stall
+		}
+	}
+	return pressure, nil
+}
+
+// parsePressureTrigger parses trigger in "<resource> <some|full> <stall> <window>"
+// form (e.g. "memory some 150ms 1s") into pressure file path and kernel trigger.
+func (s *Sys) parsePressureTrigger(trigger string) (string, string, error) {
+	fields := strings.Fields(strings.ToLower(trigger))
+	if len(fields) != 4 {
+		return "", "", fmt.Errorf("Trigger must be `<resource> <some|full> <stall> <window>`")
+	}
+	if !sysPressureResources[fields[0]] {
+		return "", "", fmt.Errorf("Wrong resource `%s`", fields[0])
+	}
+	if fields[1] != "some" && fields[1] != "full" {
+		return "", "", fmt.Errorf("Wrong stall type `%s`", fields[1])
+	}
+	stall, err := time.ParseDuration(fields[2])
+	if err != nil {
+		return "", "", err
+	}
+	window, err := time.ParseDuration(fields[3])
+	if err != nil {
+		return "", "", err
+	}
+	if stall <= 0 || stall > window {
+		return "", "", fmt.Errorf("Stall must be positive and not longer than window")
+	}
+	path := filepath.Join(s.procfs, "pressure", fields[0])
+	return path, fmt.Sprintf("%s %d %d", fields[1], stall.Microseconds(), window.Microseconds()), nil
+}
+
+func (s *Sys) Evented() bool {
+	return s.pressure != nil
+}
+
+func (s *Sys) SetInterval(interval time.Duration) {
+	s.interval = interval
+}
+
+// GetEvented waits for any of pressure triggers to fire, but no longer than
+// config:`pollInterval`, so that other metrics are still updated regularly.
+func (s *Sys) GetEvented() (interface{}, error) {
+	select {
+	case <-s.pressure:
+		// Pressure might be cached due to its own interval.
+		for i := range s.metrics {
+			if s.metrics[i].name == "pressure" {
+				s.metrics[i].updated = time.Time{}
+			}
+		}
+	case <-time.After(s.interval):
+	}
+	return s.Get()
+}
+
+func (s *Sys) getMemory(resp *sysResponse) error {
+	m, err := mem.VirtualMemory()
+	if err != nil {
+		return err
+	}
+	resp.Memory.Total = bytonizeUint(m.Total, false, s.shorts)
+	resp.Memory.UsedF = bytonizeUint(m.Used, false, s.shorts)
+	resp.Memory.UsedA = bytonizeUint(m.Total-m.Available, false, s.shorts)
+	resp.Memory.TotalBytes = m.Total
+	resp.Memory.UsedFBytes = m.Used
+	resp.Memory.UsedABytes = m.Total - m.Available
+	resp.Memory.Percent = m.UsedPercent
+	return nil
+}
+
+func (s *Sys) getSwap(resp *sysResponse) error {
+	m, err := mem.SwapMemory()
+	if err != nil {
+		return err
+	}
+	resp.Swap.Total = bytonizeUint(m.Total, false, s.shorts)
+	resp.Swap.Used = bytonizeUint(m.Used, false, s.shorts)
+	resp.Swap.TotalBytes = m.Total
+	resp.Swap.UsedBytes = m.Used
+	resp.Swap.Percent = m.UsedPercent
+	return nil
+}
+
+// getDisk gets usage of given mountpoints. Mountpoints which cannot
+// be read are skipped and the last error is returned.
+func (s *Sys) getDisk(resp *sysResponse, mountpoints []string) (err error) {
+	resp.Disk = make(map[string]sysResponseDisk)
+	for _, mountpoint := range mountpoints {
+		usage, _err := disk.Usage(mountpoint)
+		if _err != nil {
+			err = _err
+			continue
+		}
+		resp.Disk[mountpoint] = sysResponseDisk{
+			Total:         bytonizeUint(usage.Total, false, s.shorts),
+			Used:          bytonizeUint(usage.Used, false, s.shorts),
+			Free:          bytonizeUint(usage.Free, false, s.shorts),
+			TotalBytes:    usage.Total,
+			UsedBytes:     usage.Used,
+			FreeBytes:     usage.Free,
+			Percent:       usage.UsedPercent,
+			InodesTotal:   usage.InodesTotal,
+			InodesUsed:    usage.InodesUsed,
+			InodesFree:    usage.InodesFree,
+			InodesPercent: usage.InodesUsedPercent,
+		}
+	}
+	return err
+}
+
+// mergeSysResponse copies fields filled in src into dst.
+// Maps are copied key by key, so that modifying dst never affects src.
+func mergeSysResponse(dst, src *sysResponse) {
+	mergeValue(reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem())
+}
+
+func mergeValue(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Struct:
+		for i := 0; i < src.NumField(); i++ {
+			mergeValue(dst.Field(i), src.Field(i))
+		}
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMap(src.Type()))
+		}
+		iter := src.MapRange()
+		for iter.Next() {
+			value := iter.Value()
+			if value.Kind() == reflect.Map {
+				inner := reflect.New(value.Type()).Elem()
+				if existing := dst.MapIndex(iter.Key()); existing.IsValid() {
+					inner.Set(existing)
 				}
+				mergeValue(inner, value)
+				value = inner
+			}
+			dst.SetMapIndex(iter.Key(), value)
+		}
+	default:
+		if !src.IsZero() {
+			dst.Set(src)
+		}
+	}
+}
+
+// nameMatches checks whether name matches given glob patterns.
+// Patterns starting with `!` exclude matching names.
+// Without any including pattern, all names not excluded match.
+func nameMatches(patterns []string, name string) bool {
+	included, including := false, false
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			if ok, _ := filepath.Match(pattern[1:], name); ok {
+				return false
+			}
+			continue
+		}
+		including = true
+		if ok, _ := filepath.Match(pattern, name); ok {
+			included = true
+		}
+	}
+	return included || !including
+}
+
+// getNetwork gathers statistics for interfaces matching given patterns.
+// If the first pattern is `all`, a single aggregate is returned instead.
+func (s *Sys) getNetwork(samples rates, counters []net.IOCountersStat, interfaces []net.InterfaceStat, patterns []string, now time.Time) map[string]sysResponseNetwork {
+	aggregate := len(patterns) > 0 && strings.ToLower(patterns[0]) == "all"
+	if aggregate {
+		patterns = patterns[1:]
+	}
+
+	details := make(map[string]net.InterfaceStat)
+	for _, iface := range interfaces {
+		details[iface.Name] = iface
+	}
+
+	networks := make(map[string]sysResponseNetwork)
+	all := net.IOCountersStat{Name: "all"}
+	for _, counter := range counters {
+		if !nameMatches(patterns, counter.Name) {
+			continue
+		}
+		if !aggregate {
+			networks[counter.Name] = s.getNetworkInterface(samples, counter, details[counter.Name], now)
+			continue
+		}
+		all.BytesSent += counter.BytesSent
+		all.BytesRecv += counter.BytesRecv
+		all.Errin += counter.Errin
+		all.Errout += counter.Errout
+		all.Dropin += counter.Dropin
+		all.Dropout += counter.Dropout
+	}
+	if aggregate {
+		networks["all"] = s.getNetworkInterface(samples, all, net.InterfaceStat{}, now)
+	}
+	return networks
+}
+
+func (s *Sys) getNetworkInterface(samples rates, counter net.IOCountersStat, iface net.InterfaceStat, now time.Time) sysResponseNetwork {
+	nic := sysResponseNetwork{
+		SentBytes: counter.BytesSent,
+		RecvBytes: counter.BytesRecv,
+		ErrorsIn:  counter.Errin,
+		ErrorsOut: counter.Errout,
+		DropsIn:   counter.Dropin,
+		DropsOut:  counter.Dropout,
+		MAC:       iface.HardwareAddr,
+		MTU:       iface.MTU,
+	}
+	nic.Sent = bytonizeUint(nic.SentBytes, false, s.shorts)
+	nic.Recv = bytonizeUint(nic.RecvBytes, false, s.shorts)
+
+	key := "network/" + counter.Name
+	download, ok := samples.rate(key+"/recv", counter.BytesRecv, now)
+	if ok {
+		nic.DownloadBytes = download
+		nic.Download = bytonizeUint(uint64(download), true, s.shorts)
+	}
+	upload, ok := samples.rate(key+"/sent", counter.BytesSent, now)
+	if ok {
+		nic.UploadBytes = upload
+		nic.Upload = bytonizeUint(uint64(upload), true, s.shorts)
+	}
+
+	if iface.Name != "" {
+		state, err := ioutil.ReadFile(filepath.Join(s.sysfs, "class", "net", iface.Name, "operstate"))
+		if err == nil {
+			nic.State = strings.TrimSpace(string(state))
+		}
+	}
+	for _, addr := range iface.Addrs {
+		ip := strings.SplitN(addr.Addr, "/", 2)[0]
+		if strings.Contains(ip, ":") {
+			nic.IPv6 = append(nic.IPv6, ip)
+		} else {
+			nic.IPv4 = append(nic.IPv4, ip)
+		}
+	}
+	return nic
+}
+
+// getDiskIOs gets I/O rates of given devices. Devices which are not
+// found are skipped and the last error is returned.
+func (s *Sys) getDiskIOs(
+	samples rates, counters map[string]disk.IOCountersStat, devices []string, now time.Time,
+) (map[string]sysResponseDiskIO, error) {
+	var err error
+	diskio := make(map[string]sysResponseDiskIO)
+	for _, device := range devices {
+		counter, ok := counters[device]
+		if !ok {
+			err = fmt.Errorf("Sys: device `%s` not found", device)
+			continue
+		}
+		diskio[device] = s.getDiskIO(samples, counter, now)
+	}
+	return diskio, err
+}
+
+func (s *Sys) getDiskIO(samples rates, counter disk.IOCountersStat, now time.Time) sysResponseDiskIO {
+	key := "diskio/" + counter.Name
+	io := sysResponseDiskIO{}
+	var ok bool
+	if io.ReadBytes, ok = samples.rate(key+"/read", counter.ReadBytes, now); ok {
+		io.Read = bytonizeUint(uint64(io.ReadBytes), true, s.shorts)
+	}
+	if io.WriteBytes, ok = samples.rate(key+"/write", counter.WriteBytes, now); ok {
+		io.Write = bytonizeUint(uint64(io.WriteBytes), true, s.shorts)
+	}
+	io.ReadIOPS, _ = samples.rate(key+"/reads", counter.ReadCount, now)
+	io.WriteIOPS, _ = samples.rate(key+"/writes", counter.WriteCount, now)
+	// IoTime is in milliseconds.
+	busy, _ := samples.rate(key+"/busy", counter.IoTime, now)
+	io.Busy = math.Min(busy/10, 100)
+	return io
+}
+
+// readProcStat reads lines from `/proc/stat` starting with given prefix,
+// split into fields.
+func (s *Sys) readProcStat(prefix string) ([][]string, error) {
+	file, err := os.Open(filepath.Join(s.procfs, "stat"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines [][]string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), prefix) {
+			lines = append(lines, strings.Fields(scanner.Text()))
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// getCPUTimes computes share of time spent in each state since the last call.
+// For cumulative, value is stored as `cpu0`.
+func (s *Sys) getCPUTimes(percpu bool) (map[string]sysResponseCPUTimes, error) {
+	lines, err := s.readProcStat("cpu")
+	if err != nil {
+		return nil, err
+	}
+
+	times := make(map[string]sysResponseCPUTimes)
+	for _, fields := range lines {
+		if (fields[0] == "cpu") == percpu {
+			continue
+		}
+		if len(fields) < 9 {
+			return nil, fmt.Errorf("Sys: wrong `%s` stat format", fields[0])
+		}
+
+		values := make([]uint64, 8)
+		for i := range values {
+			values[i], _ = strconv.ParseUint(fields[i+1], 10, 64)
+		}
+		prev := s.cpuTimes[fields[0]]
+		s.cpuTimes[fields[0]] = values
+		for i := range prev {
+			// Counters went back (e.g. cpu went offline), start over.
+			if values[i] < prev[i] {
+				prev = nil
+				break
+			}
+		}
+
+		deltas := make([]float64, 8)
+		var total float64
+		for i, value := range values {
+			if prev != nil {
+				value -= prev[i]
 			}
+			deltas[i] = float64(value)
+			total += deltas[i]
 		}
+		if total == 0 {
+			total = 1
+		}
+		for i := range deltas {
+			deltas[i] = deltas[i] / total * 100
+		}
+		name := fields[0]
+		if name == "cpu" {
+			name = "cpu0"
+		}
+		times[name] = sysResponseCPUTimes{
+			User: deltas[0], Nice: deltas[1], System: deltas[2], Idle: deltas[3],
+			Iowait: deltas[4], Irq: deltas[5], Softirq: deltas[6], Steal: deltas[7],
+		}
+	}
+	return times, nil
+}
+
+// getCPUFreq reads current frequency from `/proc/cpuinfo`
+// and limits from sysfs cpufreq, if available.
+func (s *Sys) getCPUFreq() (map[string]sysResponseCPUFreq, error) {
+	file, err := os.Open(filepath.Join(s.procfs, "cpuinfo"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	freqs := make(map[string]sysResponseCPUFreq)
+	var name string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		split := strings.SplitN(scanner.Text(), ":", 2)
+		if len(split) < 2 {
+			continue
+		}
+		key, value := strings.TrimSpace(split[0]), strings.TrimSpace(split[1])
+		switch key {
+		case "processor":
+			name = "cpu" + value
+			freqs[name] = sysResponseCPUFreq{}
+		case "cpu MHz":
+			freq := freqs[name]
+			freq.Current, _ = strconv.ParseFloat(value, 64)
+			freqs[name] = freq
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	readKHz := func(cpu, file string) float64 {
+		data, err := ioutil.ReadFile(filepath.Join(
+			s.sysfs, "devices", "system", "cpu", cpu, "cpufreq", file,
+		))
 		if err != nil {
-			log.Printf("Sys: Cannot get `%s`: `%s`\n", metric, err)
+			return 0
 		}
+		khz, _ := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+		return khz / 1000
 	}
+	for name, freq := range freqs {
+		freq.Min = readKHz(name, "cpuinfo_min_freq")
+		freq.Max = readKHz(name, "cpuinfo_max_freq")
+		if freq.Current == 0 {
+			freq.Current = readKHz(name, "scaling_cur_freq")
+		}
+		freqs[name] = freq
+	}
+	return freqs, nil
+}
 
-	return resp, nil
+// getProcs counts processes, taking running and blocked counts
+// from `/proc/stat` and the rest from `/proc/[pid]/stat` files.
+func (s *Sys) getProcs(resp *sysResponse) error {
+	lines, err := s.readProcStat("procs_")
+	if err != nil {
+		return err
+	}
+	for _, fields := range lines {
+		if len(fields) < 2 {
+			continue
+		}
+		value, _ := strconv.ParseUint(fields[1], 10, 64)
+		switch fields[0] {
+		case "procs_running":
+			resp.Procs.Running = value
+		case "procs_blocked":
+			resp.Procs.Blocked = value
+		}
+	}
+
+	stats, err := filepath.Glob(filepath.Join(s.procfs, "[0-9]*", "stat"))
+	if err != nil {
+		return err
+	}
+	for _, stat := range stats {
+		data, err := ioutil.ReadFile(stat)
+		if err != nil {
+			// Process is already gone.
+			continue
+		}
+		resp.Procs.Total += 1
+		// Process name can contain anything, state follows the last paren.
+		i := strings.LastIndex(string(data), ")")
+		if i != -1 && i+2 < len(data) && data[i+2] == 'Z' {
+			resp.Procs.Zombie += 1
+		}
+	}
+	return nil
+}
+
+// readProcesses reads all processes from `/proc/[pid]/stat`,
+// with CPU usage (in percents of a single core) since the previous call.
+func (s *Sys) readProcesses() ([]sysResponseProcess, error) {
+	lines, err := s.readProcStat("cpu")
+	if err != nil {
+		return nil, err
+	}
+	var total uint64
+	cpus := 0
+	for _, fields := range lines {
+		if fields[0] != "cpu" {
+			cpus += 1
+			continue
+		}
+		// Guest times are already included in user times.
+		for i := 1; i < len(fields) && i <= 8; i++ {
+			value, _ := strconv.ParseUint(fields[i], 10, 64)
+			total += value
+		}
+	}
+	if cpus == 0 {
+		cpus = 1
+	}
+	var elapsed float64
+	if s.cpuTotal != 0 && total > s.cpuTotal {
+		elapsed = float64(total-s.cpuTotal) / float64(cpus)
+	}
+	s.cpuTotal = total
+
+	stats, err := filepath.Glob(filepath.Join(s.procfs, "[0-9]*", "stat"))
+	if err != nil {
+		return nil, err
+	}
+	pageSize := uint64(os.Getpagesize())
+	ticks := make(map[int]sysProcessTicks, len(stats))
+	processes := make([]sysResponseProcess, 0, len(stats))
+	for _, stat := range stats {
+		data, err := ioutil.ReadFile(stat)
+		if err != nil {
+			// Process is already gone.
+			continue
+		}
+		// Process name can contain anything, it is enclosed
+		// between the first and the last paren.
+		start, end := strings.Index(string(data), "("), strings.LastIndex(string(data), ")")
+		if start == -1 || end < start {
+			continue
+		}
+		fields := strings.Fields(string(data[end+1:]))
+		if len(fields) < 22 {
+			continue
+		}
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(data[:start])))
+		utime, _ := strconv.ParseUint(fields[11], 10, 64)
+		stime, _ := strconv.ParseUint(fields[12], 10, 64)
+		starttime, _ := strconv.ParseUint(fields[19], 10, 64)
+		rss, _ := strconv.ParseUint(fields[21], 10, 64)
+
+		process := sysResponseProcess{
+			PID:      pid,
+			Name:     string(data[start+1 : end]),
+			RSSBytes: rss * pageSize,
+		}
+		process.RSS = bytonizeUint(process.RSSBytes, false, s.shorts)
+
+		current := sysProcessTicks{ticks: utime + stime, start: starttime}
+		prev, ok := s.procTicks[pid]
+		if ok && prev.start == current.start && current.ticks >= prev.ticks && elapsed > 0 {
+			process.CPU = float64(current.ticks-prev.ticks) / elapsed * 100
+		}
+		ticks[pid] = current
+
+		processes = append(processes, process)
+	}
+	s.procTicks = ticks
+	return processes, nil
+}
+
+// sysProcesses sorts processes by either `cpu` or `mem` usage, descending.
+type sysProcesses struct {
+	processes []sysResponseProcess
+	by        string
+}
+
+func (p sysProcesses) Len() int      { return len(p.processes) }
+func (p sysProcesses) Swap(i, j int) { p.processes[i], p.processes[j] = p.processes[j], p.processes[i] }
+func (p sysProcesses) Less(i, j int) bool {
+	a, b := p.processes[i], p.processes[j]
+	if p.by == "mem" && a.RSSBytes != b.RSSBytes {
+		return a.RSSBytes > b.RSSBytes
+	}
+	if p.by == "cpu" && a.CPU != b.CPU {
+		return a.CPU > b.CPU
+	}
+	return a.PID < b.PID
+}
+
+// topProcesses returns at most n processes with names matching
+// given patterns, sorted by either `cpu` or `mem` usage.
+func topProcesses(processes []sysResponseProcess, n int, by string, patterns []string) []sysResponseProcess {
+	top := make([]sysResponseProcess, 0, len(processes))
+	for _, process := range processes {
+		if nameMatches(patterns, process.Name) {
+			top = append(top, process)
+		}
+	}
+	sort.Sort(sysProcesses{top, by})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// getWifi gathers wireless link information from `/proc/net/wireless`
+// and nl80211. Either one is enough, as long as it knows the interface.
+func (s *Sys) getWifi(name string) (sysResponseWifi, error) {
+	wifi := sysResponseWifi{}
+	procErr := s.readWireless(name, &wifi)
+	if err := getNl80211(name, &wifi); err != nil && procErr != nil {
+		return wifi, err
+	}
+	if procErr != nil && wifi.Signal != 0 {
+		// Usual mapping of -100..-50 dBm to 0..100%.
+		wifi.Quality = math.Max(0, math.Min(100, 2*(wifi.Signal+100)))
+	}
+	return wifi, nil
 }
 
-func (s *Sys) getNetworkByName(nices []net.IOCountersStat, name string) sysResponseNetwork {
-	net := sysResponseNetwork{}
-	for _, nic := range nices {
-		if nic.Name == name {
-			net.Sent = bytonizeUint(nic.BytesSent, false, s.shorts)
-			net.Recv = bytonizeUint(nic.BytesRecv, false, s.shorts)
-			net.Download = bytonizeUint(
-				uint64((float64(nic.BytesRecv)-float64(s.downloaded[name]))/s.interval),
-				true, s.shorts,
-			)
-			s.downloaded[name] = nic.BytesRecv
-			net.Upload = bytonizeUint(
-				uint64((float64(nic.BytesSent)-float64(s.uploaded[name]))/s.interval),
-				true, s.shorts,
-			)
-			s.uploaded[name] = nic.BytesSent
+// readWireless reads link quality and signal level from `/proc/net/wireless`.
+func (s *Sys) readWireless(name string, wifi *sysResponseWifi) error {
+	file, err := os.Open(filepath.Join(s.procfs, "net", "wireless"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || strings.TrimSuffix(fields[0], ":") != name {
+			continue
 		}
+		// Link quality is usually reported in 0..70 range.
+		link, _ := strconv.ParseFloat(fields[2], 64)
+		wifi.Quality = math.Min(100, link/70*100)
+		wifi.Signal, _ = strconv.ParseFloat(fields[3], 64)
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("Sys: interface `%s` is not wireless", name)
+}
+
+const (
+	netlinkHeaderLen = 16
+
+	nlmsgError = 2
+	nlmsgDone  = 3
+	nlmFMulti  = 2
+
+	genlIDCtrl         = 16
+	ctrlCmdGetFamily   = 3
+	ctrlAttrFamilyID   = 1
+	ctrlAttrFamilyName = 2
+
+	nl80211CmdGetInterface   = 5
+	nl80211CmdGetStation     = 17
+	nl80211CmdNewStation     = 19
+	nl80211AttrIfindex       = 3
+	nl80211AttrMAC           = 6
+	nl80211AttrStaInfo       = 21
+	nl80211AttrWiphyFreq     = 38
+	nl80211AttrSSID          = 52
+	nl80211StaInfoSignal     = 7
+	nl80211StaInfoTxBitrate  = 8
+	nl80211RateInfoBitrate   = 1
+	nl80211RateInfoBitrate32 = 5
+)
+
+// nativeEndian is byte order of the host, which netlink uses.
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
 	}
-	return net
+	return binary.BigEndian
+}()
+
+// netlinkMessage is a single netlink message with header stripped.
+type netlinkMessage struct {
+	Type  uint16
+	Flags uint16
+	Data  []byte
+}
+
+func netlinkAlign(length int) int {
+	return (length + 3) &^ 3
+}
+
+// netlinkAttr encodes single netlink attribute.
+func netlinkAttr(typ uint16, data []byte) []byte {
+	attr := make([]byte, netlinkAlign(4+len(data)))
+	nativeEndian.PutUint16(attr[0:2], uint16(4+len(data)))
+	nativeEndian.PutUint16(attr[2:4], typ)
+	copy(attr[4:], data)
+	return attr
+}
+
+// genlMessage encodes generic netlink request.
+func genlMessage(family uint16, flags uint16, cmd uint8, attrs ...[]byte) []byte {
+	msg := make([]byte, netlinkHeaderLen+4)
+	nativeEndian.PutUint16(msg[4:6], family)
+	nativeEndian.PutUint16(msg[6:8], flags)
+	nativeEndian.PutUint32(msg[8:12], 1)
+	msg[netlinkHeaderLen] = cmd
+	msg[netlinkHeaderLen+1] = 1
+	for _, attr := range attrs {
+		msg = append(msg, attr...)
+	}
+	nativeEndian.PutUint32(msg[0:4], uint32(len(msg)))
+	return msg
+}
+
+// parseNetlinkMessages splits received buffer into netlink messages.
+// Reports true if the reply is complete and no more messages should be read.
+func parseNetlinkMessages(buf []byte) ([]netlinkMessage, bool, error) {
+	var msgs []netlinkMessage
+	done := false
+	for len(buf) >= netlinkHeaderLen {
+		length := int(nativeEndian.Uint32(buf[0:4]))
+		if length < netlinkHeaderLen || length > len(buf) {
+			return nil, true, fmt.Errorf("Malformed netlink message")
+		}
+		msg := netlinkMessage{
+			Type:  nativeEndian.Uint16(buf[4:6]),
+			Flags: nativeEndian.Uint16(buf[6:8]),
+			Data:  buf[netlinkHeaderLen:length],
+		}
+		switch msg.Type {
+		case nlmsgError:
+			if len(msg.Data) < 4 {
+				return nil, true, fmt.Errorf("Malformed netlink message")
+			}
+			if errno := int32(nativeEndian.Uint32(msg.Data[0:4])); errno != 0 {
+				return nil, true, syscall.Errno(-errno)
+			}
+			return msgs, true, nil
+		case nlmsgDone:
+			return msgs, true, nil
+		}
+		msgs = append(msgs, msg)
+		done = msg.Flags&nlmFMulti == 0
+
+		if length = netlinkAlign(length); length > len(buf) {
+			length = len(buf)
+		}
+		buf = buf[length:]
+	}
+	return msgs, done, nil
+}
+
+// parseNetlinkAttrs splits buffer into netlink attributes, keyed by type.
+func parseNetlinkAttrs(buf []byte) map[uint16][]byte {
+	attrs := make(map[uint16][]byte)
+	for len(buf) >= 4 {
+		length := int(nativeEndian.Uint16(buf[0:2]))
+		if length < 4 || length > len(buf) {
+			break
+		}
+		// Strip nested and byte order flags.
+		attrs[nativeEndian.Uint16(buf[2:4])&0x3fff] = buf[4:length]
+
+		if length = netlinkAlign(length); length > len(buf) {
+			length = len(buf)
+		}
+		buf = buf[length:]
+	}
+	return attrs
+}
+
+// parseGenlFamilyID finds family id in generic netlink controller reply.
+func parseGenlFamilyID(msgs []netlinkMessage) (uint16, error) {
+	for _, msg := range msgs {
+		if len(msg.Data) < 4 {
+			continue
+		}
+		id := parseNetlinkAttrs(msg.Data[4:])[ctrlAttrFamilyID]
+		if len(id) >= 2 {
+			return nativeEndian.Uint16(id), nil
+		}
+	}
+	return 0, fmt.Errorf("Generic netlink family not found")
+}
+
+// parseNl80211 fills wireless information from nl80211 interface
+// and station replies.
+func parseNl80211(msgs []netlinkMessage, wifi *sysResponseWifi) {
+	for _, msg := range msgs {
+		if len(msg.Data) < 4 {
+			continue
+		}
+		attrs := parseNetlinkAttrs(msg.Data[4:])
+		if ssid, ok := attrs[nl80211AttrSSID]; ok {
+			wifi.SSID = string(ssid)
+		}
+		if freq := attrs[nl80211AttrWiphyFreq]; len(freq) >= 4 {
+			wifi.Frequency = float64(nativeEndian.Uint32(freq))
+		}
+		if msg.Data[0] != nl80211CmdNewStation {
+			continue
+		}
+
+		// For station, MAC is the one of access point.
+		if mac := attrs[nl80211AttrMAC]; len(mac) == 6 {
+			wifi.BSSID = fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x",
+				mac[0], mac[1], mac[2], mac[3], mac[4], mac[5])
+		}
+		info := parseNetlinkAttrs(attrs[nl80211AttrStaInfo])
+		if signal := info[nl80211StaInfoSignal]; len(signal) >= 1 {
+			wifi.Signal = float64(int8(signal[0]))
+		}
+		// Bitrates are in 100 kbit/s.
+		rate := parseNetlinkAttrs(info[nl80211StaInfoTxBitrate])
+		if bitrate := rate[nl80211RateInfoBitrate32]; len(bitrate) >= 4 {
+			wifi.Bitrate = float64(nativeEndian.Uint32(bitrate)) / 10
+		} else if bitrate := rate[nl80211RateInfoBitrate]; len(bitrate) >= 2 {
+			wifi.Bitrate = float64(nativeEndian.Uint16(bitrate)) / 10
+		}
+	}
+}
+
+// readSysfsFloat reads a single number from sysfs file.
+func readSysfsFloat(path string) (float64, bool) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	return value, err == nil
+}
+
+// sensorMatches checks whether sensor matches any of given "chip" or
+// "chip/label" glob patterns. No patterns match everything.
+func sensorMatches(patterns []string, chip, label string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	chip, label = strings.ToLower(chip), strings.ToLower(label)
+	for _, pattern := range patterns {
+		split := strings.SplitN(pattern, "/", 2)
+		if ok, _ := filepath.Match(split[0], chip); !ok {
+			continue
+		}
+		if len(split) == 1 {
+			return true
+		}
+		if ok, _ := filepath.Match(split[1], label); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// getSensors reads temperatures and fan speeds from hwmon
+// and temperatures from thermal zones.
+func (s *Sys) getSensors(resp *sysResponse, patterns []string) error {
+	resp.Temp = make(map[string]map[string]sysResponseTemp)
+	resp.Fan = make(map[string]map[string]sysResponseFan)
+
+	hwmons, err := filepath.Glob(filepath.Join(s.sysfs, "class", "hwmon", "hwmon*"))
+	if err != nil {
+		return err
+	}
+	for _, hwmon := range hwmons {
+		// Older kernels keep everything in the device directory.
+		dir := hwmon
+		name, err := ioutil.ReadFile(filepath.Join(dir, "name"))
+		if err != nil {
+			dir = filepath.Join(hwmon, "device")
+			if name, err = ioutil.ReadFile(filepath.Join(dir, "name")); err != nil {
+				continue
+			}
+		}
+		chip := strings.TrimSpace(string(name))
+		if _, ok := resp.Temp[chip]; ok {
+			chip += "-" + filepath.Base(hwmon)
+		}
+		resp.Temp[chip] = make(map[string]sysResponseTemp)
+		resp.Fan[chip] = make(map[string]sysResponseFan)
+
+		inputs, _ := filepath.Glob(filepath.Join(dir, "*_input"))
+		for _, input := range inputs {
+			prefix := strings.TrimSuffix(input, "_input")
+			label := filepath.Base(prefix)
+			if data, err := ioutil.ReadFile(prefix + "_label"); err == nil {
+				label = strings.TrimSpace(string(data))
+			}
+			if !sensorMatches(patterns, chip, label) {
+				continue
+			}
+			value, ok := readSysfsFloat(input)
+			if !ok {
+				continue
+			}
+
+			switch {
+			case strings.HasPrefix(filepath.Base(prefix), "temp"):
+				high, _ := readSysfsFloat(prefix + "_max")
+				critical, _ := readSysfsFloat(prefix + "_crit")
+				resp.Temp[chip][label] = sysResponseTemp{
+					Current:  value / 1000,
+					High:     high / 1000,
+					Critical: critical / 1000,
+				}
+			case strings.HasPrefix(filepath.Base(prefix), "fan"):
+				min, _ := readSysfsFloat(prefix + "_min")
+				max, _ := readSysfsFloat(prefix + "_max")
+				resp.Fan[chip][label] = sysResponseFan{RPM: value, Min: min, Max: max}
+			}
+		}
+	}
+
+	zones, err := filepath.Glob(filepath.Join(s.sysfs, "class", "thermal", "thermal_zone*"))
+	if err != nil {
+		return err
+	}
+	thermal := make(map[string]sysResponseTemp)
+	for _, zone := range zones {
+		data, err := ioutil.ReadFile(filepath.Join(zone, "type"))
+		if err != nil {
+			continue
+		}
+		label := strings.TrimSpace(string(data))
+		if _, ok := thermal[label]; ok {
+			label += "-" + filepath.Base(zone)
+		}
+		if !sensorMatches(patterns, "thermal", label) {
+			continue
+		}
+		value, ok := readSysfsFloat(filepath.Join(zone, "temp"))
+		if !ok {
+			continue
+		}
+
+		temp := sysResponseTemp{Current: value / 1000}
+		trips, _ := filepath.Glob(filepath.Join(zone, "trip_point_*_type"))
+		for _, trip := range trips {
+			typ, err := ioutil.ReadFile(trip)
+			if err != nil {
+				continue
+			}
+			value, _ := readSysfsFloat(strings.TrimSuffix(trip, "_type") + "_temp")
+			switch strings.TrimSpace(string(typ)) {
+			case "hot":
+				temp.High = value / 1000
+			case "critical":
+				temp.Critical = value / 1000
+			}
+		}
+		thermal[label] = temp
+	}
+	resp.Temp["thermal"] = thermal
+
+	for chip := range resp.Temp {
+		if len(resp.Temp[chip]) == 0 {
+			delete(resp.Temp, chip)
+		}
+	}
+	for chip := range resp.Fan {
+		if len(resp.Fan[chip]) == 0 {
+			delete(resp.Fan, chip)
+		}
+	}
+	return nil
 }
 
 func (s *Sys) Init(config config) error {
 	if config["metrics"] == nil {
 		return fmt.Errorf("Metrics parameter is required for Sys receiver")
 	}
-	metrics := config["metrics"].([]interface{})
-
-	s.metrics = make([]string, len(metrics))
-	s.downloaded = make(map[string]uint64)
-	s.uploaded = make(map[string]uint64)
-
-	for i, metric := range metrics {
-		s.metrics[i] = metric.(string)
+	metrics, ok := config["metrics"].([]interface{})
+	if !ok {
+		return fmt.Errorf("Sys: metrics must be a list")
 	}
 
-	interval, _ := time.ParseDuration(config["pollInterval"].(string))
-	s.interval = interval.Seconds()
+	// Invalid metrics are configuration errors, retrying Init would not
+	// help, so keep running without them instead of returning an error.
+	s.metrics = s.parseMetrics(metrics)
+	if len(s.metrics) == 0 && len(metrics) > 0 {
+		log.Printf("Sys: No valid metrics, nothing will be reported\n")
+	}
+	s.cpuTimes = make(map[string][]uint64)
 
 	if config["shorts"] != nil {
 		s.shorts = config["shorts"].(bool)
 	}
 
+	s.procfs = "/proc"
+	if config["procfs"] != nil {
+		s.procfs = config["procfs"].(string)
+	}
+	s.sysfs = "/sys"
+	if config["sysfs"] != nil {
+		s.sysfs = config["sysfs"].(string)
+	}
+	s.cgroupfs = "/sys/fs/cgroup"
+	if config["cgroupfs"] != nil {
+		s.cgroupfs = config["cgroupfs"].(string)
+	}
+
+	s.interval = time.Second
+	if interval, ok := config["pollInterval"].(string); ok {
+		if interval, err := time.ParseDuration(interval); err == nil {
+			s.interval = interval
+		}
+	}
+
+	s.pressure = nil
+	if triggers, ok := config["pressureTriggers"].([]interface{}); ok {
+		// Triggers only notify, so events from all of them can be merged.
+		events := make(chan struct{}, 1)
+		for _, trigger := range triggers {
+			path, line, err := s.parsePressureTrigger(fmt.Sprint(trigger))
+			if err == nil {
+				err = listenPressure(path, line, events)
+			}
+			if err != nil {
+				log.Printf("Sys: Cannot set pressure trigger `%v`: `%s`\n", trigger, err)
+				continue
+			}
+			s.pressure = events
+		}
+	}
+
 	return nil
 }
 
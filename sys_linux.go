@@ -0,0 +1,160 @@
+// osop
+// Copyright (C) 2026 Karol 'Kenji Takahashi' Woźniak
+//
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+// OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"log"
+	"net"
+	"syscall"
+)
+
+// getNl80211 fills wireless information of given interface,
+// querying nl80211 over generic netlink.
+func getNl80211(name string, wifi *sysResponseWifi) error {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+
+	fd, err := syscall.Socket(
+		syscall.AF_NETLINK,
+		syscall.SOCK_RAW|syscall.SOCK_CLOEXEC,
+		syscall.NETLINK_GENERIC,
+	)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK})
+	if err != nil {
+		return err
+	}
+
+	msgs, err := genlRequest(fd, genlIDCtrl, syscall.NLM_F_REQUEST, ctrlCmdGetFamily,
+		netlinkAttr(ctrlAttrFamilyName, []byte("nl80211\x00")))
+	if err != nil {
+		return err
+	}
+	family, err := parseGenlFamilyID(msgs)
+	if err != nil {
+		return err
+	}
+
+	ifindex := make([]byte, 4)
+	nativeEndian.PutUint32(ifindex, uint32(iface.Index))
+	msgs, err = genlRequest(fd, family, syscall.NLM_F_REQUEST, nl80211CmdGetInterface,
+		netlinkAttr(nl80211AttrIfindex, ifindex))
+	if err != nil {
+		return err
+	}
+	parseNl80211(msgs, wifi)
+
+	msgs, err = genlRequest(fd, family, syscall.NLM_F_REQUEST|syscall.NLM_F_DUMP, nl80211CmdGetStation,
+		netlinkAttr(nl80211AttrIfindex, ifindex))
+	if err != nil {
+		return err
+	}
+	parseNl80211(msgs, wifi)
+	return nil
+}
+
+// genlRequest sends generic netlink request and collects all the replies.
+func genlRequest(fd int, family uint16, flags uint16, cmd uint8, attrs ...[]byte) ([]netlinkMessage, error) {
+	err := syscall.Sendto(fd, genlMessage(family, flags, cmd, attrs...), 0,
+		&syscall.SockaddrNetlink{Family: syscall.AF_NETLINK})
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []netlinkMessage
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Messages keep referencing the buffer, so it cannot be reused.
+		received, done, err := parseNetlinkMessages(append([]byte(nil), buf[:n]...))
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, received...)
+		if done {
+			return msgs, nil
+		}
+	}
+}
+
+// listenPressure registers PSI trigger on given pressure file.
+// Every time the stall threshold is crossed, events is notified.
+func listenPressure(path string, trigger string, events chan<- struct{}) error {
+	fd, err := syscall.Open(path, syscall.O_RDWR|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := syscall.Write(fd, append([]byte(trigger), 0)); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	err = syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, fd, &syscall.EpollEvent{
+		Events: syscall.EPOLLPRI,
+		Fd:     int32(fd),
+	})
+	if err != nil {
+		syscall.Close(epfd)
+		syscall.Close(fd)
+		return err
+	}
+
+	go func() {
+		defer syscall.Close(fd)
+		defer syscall.Close(epfd)
+		ready := make([]syscall.EpollEvent, 1)
+		for {
+			n, err := syscall.EpollWait(epfd, ready, -1)
+			if err == syscall.EINTR {
+				continue
+			}
+			if err == nil && n > 0 && ready[0].Events&syscall.EPOLLERR != 0 {
+				err = syscall.EIO
+			}
+			if err != nil {
+				log.Printf("Sys: Pressure trigger `%s` stopped: `%s`\n", path, err)
+				return
+			}
+			select {
+			case events <- struct{}{}:
+			default:
+				// Previous event was not handled yet, no need to pile up.
+			}
+		}
+	}()
+	return nil
+}
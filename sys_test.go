@@ -0,0 +1,869 @@
+// osop
+// Copyright (C) 2026 Karol 'Kenji Takahashi' Woźniak
+//
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+// OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/disk"
+	"github.com/shirou/gopsutil/net"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestSys creates Sys with given metrics, working on fake procfs,
+// sysfs and cgroupfs trees with given files. Returned function cleans them up.
+func newTestSys(t *testing.T, metrics []interface{}, files map[string]string) (*Sys, func()) {
+	root, err := ioutil.TempDir("", "osop")
+	assert.Nil(t, err)
+	writeFakeFiles(t, root, files)
+
+	s := &Sys{}
+	assert.Nil(t, s.Init(config{
+		"metrics":      metrics,
+		"pollInterval": "1s",
+		"procfs":       root + "/proc",
+		"sysfs":        root + "/sys",
+		"cgroupfs":     root + "/cgroup",
+	}))
+	return s, func() { os.RemoveAll(root) }
+}
+
+var sysTestProcStat = `cpu  100 10 50 800 20 5 5 10 0 0
+cpu0 60 5 25 400 5 3 2 0 0 0
+cpu1 40 5 25 400 15 2 3 10 0 0
+intr 12345
+ctxt 67890
+procs_running 3
+procs_blocked 1
+`
+
+func TestSysLoadProcs(t *testing.T) {
+	s, cleanup := newTestSys(t, []interface{}{"load", "procs"}, map[string]string{
+		"proc/loadavg":   "0.52 0.58 0.59 3/467 12345\n",
+		"proc/stat":      sysTestProcStat,
+		"proc/1/stat":    "1 (systemd) S 0 1 1 0 -1",
+		"proc/42/stat":   "42 (bad) name) Z 1 42 42 0 -1",
+		"proc/43/stat":   "43 (bash) R 1 43 43 0 -1",
+		"proc/self/stat": "43 (bash) R 1 43 43 0 -1",
+	})
+	defer cleanup()
+
+	value, err := s.Get()
+	assert.Nil(t, err)
+	resp := value.(sysResponse)
+	assert.Equal(t, 0.52, resp.Load.Load1)
+	assert.Equal(t, 0.58, resp.Load.Load5)
+	assert.Equal(t, 0.59, resp.Load.Load15)
+	assert.Equal(t, uint64(3), resp.Procs.Total)
+	assert.Equal(t, uint64(3), resp.Procs.Running)
+	assert.Equal(t, uint64(1), resp.Procs.Blocked)
+	assert.Equal(t, uint64(1), resp.Procs.Zombie)
+}
+
+func TestSysCPUTimes(t *testing.T) {
+	s, cleanup := newTestSys(t, []interface{}{"cpu times"}, map[string]string{
+		"proc/stat": sysTestProcStat,
+	})
+	defer cleanup()
+
+	value, err := s.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]sysResponseCPUTimes{"cpu0": {
+		User: 10, Nice: 1, System: 5, Idle: 80, Iowait: 2, Irq: 0.5, Softirq: 0.5, Steal: 1,
+	}}, value.(sysResponse).CPU.Times)
+
+	// Next values are computed from differences.
+	writeFakeFiles(t, s.procfs, map[string]string{
+		"stat": "cpu  150 10 50 840 80 5 5 20 0 0\ncpu0 0 0 0 0 0 0 0 0 0 0\n",
+	})
+	s.metrics = s.parseMetrics([]interface{}{"cpu times true"})
+	value, err = s.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]sysResponseCPUTimes{
+		"cpu0": {},
+	}, value.(sysResponse).CPU.Times)
+	s.metrics = s.parseMetrics([]interface{}{"cpu times"})
+	writeFakeFiles(t, s.procfs, map[string]string{
+		"stat": "cpu  125 10 75 820 40 5 5 20 0 0\n",
+	})
+	value, err = s.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]sysResponseCPUTimes{"cpu0": {
+		User: 25, System: 25, Idle: 20, Iowait: 20, Steal: 10,
+	}}, value.(sysResponse).CPU.Times)
+}
+
+func TestSysCPUFreq(t *testing.T) {
+	s, cleanup := newTestSys(t, []interface{}{"cpu freq"}, map[string]string{
+		"proc/cpuinfo": "processor\t: 0\nmodel name\t: Test CPU\ncpu MHz\t\t: 1800.000\n\n" +
+			"processor\t: 1\nmodel name\t: Test CPU\n\n",
+		"sys/devices/system/cpu/cpu0/cpufreq/cpuinfo_min_freq": "400000\n",
+		"sys/devices/system/cpu/cpu0/cpufreq/cpuinfo_max_freq": "3600000\n",
+		"sys/devices/system/cpu/cpu1/cpufreq/scaling_cur_freq": "2400000\n",
+	})
+	defer cleanup()
+
+	value, err := s.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]sysResponseCPUFreq{
+		"cpu0": {Current: 1800, Min: 400, Max: 3600},
+		"cpu1": {Current: 2400},
+	}, value.(sysResponse).CPU.Freq)
+}
+
+var SysSensorsTests = []struct {
+	patterns []string
+	temps    map[string]map[string]sysResponseTemp
+	fans     map[string]map[string]sysResponseFan
+}{
+	{nil, map[string]map[string]sysResponseTemp{
+		"coretemp": {
+			"Package id 0": {Current: 45, High: 80, Critical: 100},
+			"Core 0":       {Current: 43.5, High: 80, Critical: 100},
+		},
+		"nvme":        {"temp1": {Current: 38.85}},
+		"nvme-hwmon2": {"Composite": {Current: 40}},
+		"thermal":     {"x86_pkg_temp": {Current: 46, Critical: 105}, "acpitz": {Current: 27.8}},
+	}, map[string]map[string]sysResponseFan{
+		"thinkpad": {"fan1": {RPM: 2100, Max: 5000}},
+	}},
+	{[]string{"coretemp/core*", "thermal/acpi*"}, map[string]map[string]sysResponseTemp{
+		"coretemp": {"Core 0": {Current: 43.5, High: 80, Critical: 100}},
+		"thermal":  {"acpitz": {Current: 27.8}},
+	}, map[string]map[string]sysResponseFan{}},
+	{[]string{"thinkpad"}, map[string]map[string]sysResponseTemp{}, map[string]map[string]sysResponseFan{
+		"thinkpad": {"fan1": {RPM: 2100, Max: 5000}},
+	}},
+}
+
+func TestSysSensors(t *testing.T) {
+	files := map[string]string{
+		"sys/class/hwmon/hwmon0/name":               "coretemp\n",
+		"sys/class/hwmon/hwmon0/temp1_input":        "45000\n",
+		"sys/class/hwmon/hwmon0/temp1_label":        "Package id 0\n",
+		"sys/class/hwmon/hwmon0/temp1_max":          "80000\n",
+		"sys/class/hwmon/hwmon0/temp1_crit":         "100000\n",
+		"sys/class/hwmon/hwmon0/temp2_input":        "43500\n",
+		"sys/class/hwmon/hwmon0/temp2_label":        "Core 0\n",
+		"sys/class/hwmon/hwmon0/temp2_max":          "80000\n",
+		"sys/class/hwmon/hwmon0/temp2_crit":         "100000\n",
+		"sys/class/hwmon/hwmon1/device/name":        "nvme\n",
+		"sys/class/hwmon/hwmon1/device/temp1_input": "38850\n",
+		"sys/class/hwmon/hwmon2/name":               "nvme\n",
+		"sys/class/hwmon/hwmon2/temp1_input":        "40000\n",
+		"sys/class/hwmon/hwmon2/temp1_label":        "Composite\n",
+		"sys/class/hwmon/hwmon3/name":               "thinkpad\n",
+		"sys/class/hwmon/hwmon3/fan1_input":         "2100\n",
+		"sys/class/hwmon/hwmon3/fan1_max":           "5000\n",
+		"sys/class/hwmon/hwmon4/name":               "broken\n",
+		"sys/class/hwmon/hwmon4/temp1_input":        "N/A\n",
+
+		"sys/class/thermal/thermal_zone0/type":              "acpitz\n",
+		"sys/class/thermal/thermal_zone0/temp":              "27800\n",
+		"sys/class/thermal/thermal_zone1/type":              "x86_pkg_temp\n",
+		"sys/class/thermal/thermal_zone1/temp":              "46000\n",
+		"sys/class/thermal/thermal_zone1/trip_point_0_type": "passive\n",
+		"sys/class/thermal/thermal_zone1/trip_point_0_temp": "95000\n",
+		"sys/class/thermal/thermal_zone1/trip_point_1_type": "critical\n",
+		"sys/class/thermal/thermal_zone1/trip_point_1_temp": "105000\n",
+	}
+
+	for i, tt := range SysSensorsTests {
+		metric := "temp"
+		for _, pattern := range tt.patterns {
+			metric += " " + pattern
+		}
+		s, cleanup := newTestSys(t, []interface{}{metric}, files)
+
+		value, err := s.Get()
+		assert.Nil(t, err, "%d", i)
+		resp := value.(sysResponse)
+		assert.Equal(t, tt.temps, resp.Temp, "%d", i)
+		assert.Equal(t, tt.fans, resp.Fan, "%d", i)
+
+		cleanup()
+	}
+}
+
+var SysNetworkTests = []struct {
+	patterns []string
+	expected []string
+}{
+	{nil, []string{"lo", "eth0", "wlan0", "wlp3s0"}},
+	{[]string{"wl*"}, []string{"wlan0", "wlp3s0"}},
+	{[]string{"!lo"}, []string{"eth0", "wlan0", "wlp3s0"}},
+	{[]string{"wl*", "!wlan0"}, []string{"wlp3s0"}},
+	{[]string{"eth0", "wlan0"}, []string{"eth0", "wlan0"}},
+	{[]string{"all", "!lo"}, []string{"all"}},
+}
+
+var sysTestCounters = []net.IOCountersStat{
+	{Name: "lo", BytesSent: 1000, BytesRecv: 1000},
+	{Name: "eth0", BytesSent: 200, BytesRecv: 4000, Errin: 1, Dropout: 2},
+	{Name: "wlan0", BytesSent: 300, BytesRecv: 6000, Errout: 3, Dropin: 4},
+	{Name: "wlp3s0"},
+}
+
+func TestSysNetwork(t *testing.T) {
+	for i, tt := range SysNetworkTests {
+		s, cleanup := newTestSys(t, []interface{}{}, nil)
+
+		networks := s.getNetwork(make(rates), sysTestCounters, nil, tt.patterns, time.Now())
+		names := []string{}
+		for name := range networks {
+			names = append(names, name)
+		}
+		assert.ElementsMatch(t, tt.expected, names, "%d", i)
+
+		cleanup()
+	}
+}
+
+func TestSysNetworkAggregate(t *testing.T) {
+	s, cleanup := newTestSys(t, []interface{}{}, nil)
+	defer cleanup()
+
+	now := time.Now()
+	all := s.getNetwork(make(rates), sysTestCounters, nil, []string{"all", "!lo"}, now)["all"]
+	assert.Equal(t, uint64(500), all.SentBytes)
+	assert.Equal(t, uint64(10000), all.RecvBytes)
+	assert.Equal(t, "", all.Download)
+	assert.Equal(t, uint64(1), all.ErrorsIn)
+	assert.Equal(t, uint64(3), all.ErrorsOut)
+	assert.Equal(t, uint64(4), all.DropsIn)
+	assert.Equal(t, uint64(2), all.DropsOut)
+
+	// Aggregates would overwrite each other.
+	logR.Reset()
+	metrics := s.parseMetrics([]interface{}{"network all wl*", "network eth0", "network ALL en*"})
+	assert.Len(t, metrics, 2)
+	assert.Equal(t, "network eth0", metrics[1].metric)
+	assert.Contains(t, logR.String(), "only one `network all` metric is allowed")
+}
+
+func TestSysNetworkDetails(t *testing.T) {
+	s, cleanup := newTestSys(t, []interface{}{}, map[string]string{
+		"sys/class/net/wlan0/operstate": "up\n",
+	})
+	defer cleanup()
+
+	interfaces := []net.InterfaceStat{{
+		Name:         "wlan0",
+		MTU:          1500,
+		HardwareAddr: "aa:bb:cc:dd:ee:ff",
+		Addrs: []net.InterfaceAddr{
+			{Addr: "192.168.1.10/24"},
+			{Addr: "fe80::1/64"},
+		},
+	}}
+	wlan0 := s.getNetwork(make(rates), sysTestCounters, interfaces, []string{"wlan0"}, time.Now())["wlan0"]
+	assert.Equal(t, "up", wlan0.State)
+	assert.Equal(t, "aa:bb:cc:dd:ee:ff", wlan0.MAC)
+	assert.Equal(t, 1500, wlan0.MTU)
+	assert.Equal(t, []string{"192.168.1.10"}, wlan0.IPv4)
+	assert.Equal(t, []string{"fe80::1"}, wlan0.IPv6)
+}
+
+func TestSysNetworkRates(t *testing.T) {
+	s, cleanup := newTestSys(t, []interface{}{}, nil)
+	defer cleanup()
+
+	now := time.Now()
+	counters := []net.IOCountersStat{{Name: "eth0", BytesRecv: 4000, BytesSent: 200}}
+	samples := make(rates)
+	eth0 := s.getNetwork(samples, counters, nil, nil, now)["eth0"]
+	assert.Equal(t, float64(0), eth0.DownloadBytes)
+	assert.Equal(t, "", eth0.Download)
+	assert.Equal(t, "", eth0.Upload)
+
+	// Rates are computed from actually elapsed time, not the poll interval.
+	counters = []net.IOCountersStat{{Name: "eth0", BytesRecv: 6000, BytesSent: 1200}}
+	eth0 = s.getNetwork(samples, counters, nil, nil, now.Add(4*time.Second))["eth0"]
+	assert.Equal(t, float64(500), eth0.DownloadBytes)
+	assert.Equal(t, float64(250), eth0.UploadBytes)
+	assert.NotEqual(t, "", eth0.Download)
+}
+
+var SysDiskIOTests = []struct {
+	counter  disk.IOCountersStat
+	elapsed  time.Duration
+	expected sysResponseDiskIO
+}{
+	{
+		disk.IOCountersStat{ReadBytes: 5096, WriteBytes: 2000, ReadCount: 30, WriteCount: 60, IoTime: 1100},
+		2 * time.Second,
+		sysResponseDiskIO{
+			Read: bytonizeUint(2048, true, false), Write: bytonizeUint(0, true, false),
+			ReadBytes: 2048, ReadIOPS: 10, WriteIOPS: 20, Busy: 50,
+		},
+	},
+	{
+		disk.IOCountersStat{ReadBytes: 1000, WriteBytes: 6000, ReadCount: 10, WriteCount: 20, IoTime: 5100},
+		4 * time.Second,
+		sysResponseDiskIO{
+			Read: bytonizeUint(0, true, false), Write: bytonizeUint(1000, true, false),
+			WriteBytes: 1000, Busy: 100,
+		},
+	},
+	// Counters reset, e.g. device was re-attached.
+	{
+		disk.IOCountersStat{ReadBytes: 10, WriteBytes: 20, ReadCount: 1, WriteCount: 2, IoTime: 3},
+		time.Second,
+		sysResponseDiskIO{},
+	},
+	{
+		disk.IOCountersStat{ReadBytes: 1000, WriteBytes: 2000, ReadCount: 10, WriteCount: 20, IoTime: 100},
+		0,
+		sysResponseDiskIO{},
+	},
+}
+
+func TestSysDiskIO(t *testing.T) {
+	counter := disk.IOCountersStat{ReadBytes: 1000, WriteBytes: 2000, ReadCount: 10, WriteCount: 20, IoTime: 100}
+	now := time.Now()
+	for i, tt := range SysDiskIOTests {
+		s, cleanup := newTestSys(t, []interface{}{}, nil)
+		samples := make(rates)
+
+		// First poll has nothing to compare with.
+		diskio, err := s.getDiskIOs(samples, map[string]disk.IOCountersStat{"sda": counter}, []string{"sda"}, now)
+		assert.Nil(t, err, "%d", i)
+		assert.Equal(t, map[string]sysResponseDiskIO{"sda": {}}, diskio, "%d", i)
+
+		diskio, err = s.getDiskIOs(samples, map[string]disk.IOCountersStat{"sda": tt.counter}, []string{"sda"}, now.Add(tt.elapsed))
+		assert.Nil(t, err, "%d", i)
+		assert.Equal(t, tt.expected, diskio["sda"], "%d", i)
+
+		cleanup()
+	}
+
+	// Missing devices are skipped, but reported.
+	s, cleanup := newTestSys(t, []interface{}{}, nil)
+	defer cleanup()
+	diskio, err := s.getDiskIOs(
+		make(rates), map[string]disk.IOCountersStat{"sda": counter}, []string{"sdx", "sda", "sdy"}, now,
+	)
+	assert.Equal(t, "Sys: device `sdy` not found", err.Error())
+	assert.Equal(t, map[string]sysResponseDiskIO{"sda": {}}, diskio)
+}
+
+var RatesTests = []struct {
+	prev     uint64
+	value    uint64
+	elapsed  time.Duration
+	expected float64
+	ok       bool
+}{
+	{1000, 3000, 2 * time.Second, 1000, true},
+	{1000, 1000, time.Second, 0, true},
+	{1000, 3000, 0, 0, false},
+	{1000, 3000, -time.Second, 0, false},
+	{math.MaxUint32 - 99, 100, time.Second, 200, true},
+	{5000, 100, time.Second, 0, false},
+	{math.MaxUint32 + 5000, 100, time.Second, 0, false},
+}
+
+func TestRates(t *testing.T) {
+	now := time.Now()
+	for i, tt := range RatesTests {
+		r := make(rates)
+		_, ok := r.rate("test", tt.prev, now)
+		assert.False(t, ok, "%d", i)
+
+		rate, ok := r.rate("test", tt.value, now.Add(tt.elapsed))
+		assert.Equal(t, tt.ok, ok, "%d", i)
+		assert.Equal(t, tt.expected, rate, "%d", i)
+	}
+}
+
+func TestSysWifiProc(t *testing.T) {
+	s, cleanup := newTestSys(t, []interface{}{"wifi wlantest0", "wifi ethtest0"}, map[string]string{
+		"proc/net/wireless": "Inter-| sta-|   Quality        |   Discarded packets               | Missed | WE\n" +
+			" face | tus | link level noise |  nwid  crypt   frag  retry   misc | beacon | 22\n" +
+			"wlantest0: 0000   56.  -54.  -256        0      0      0      0      0        0\n",
+	})
+	defer cleanup()
+
+	value, err := s.Get()
+	assert.Nil(t, err)
+	wifi := value.(sysResponse).Wifi
+	assert.Equal(t, sysResponseWifi{Quality: 80, Signal: -54}, wifi["wlantest0"])
+	assert.Equal(t, sysResponseWifi{}, wifi["ethtest0"])
+}
+
+// Replies captured from nl80211 on x86_64, trimmed to relevant attributes.
+var (
+	sysTestGenlFamily = []byte{
+		40, 0, 0, 0, 16, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0,
+		1, 2, 0, 0,
+		12, 0, 2, 0, 'n', 'l', '8', '0', '2', '1', '1', 0,
+		6, 0, 1, 0, 28, 0, 0, 0,
+	}
+	sysTestNl80211Interface = []byte{
+		72, 0, 0, 0, 28, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0,
+		7, 1, 0, 0,
+		8, 0, 3, 0, 3, 0, 0, 0,
+		10, 0, 4, 0, 'w', 'l', 'a', 'n', '0', 0, 0, 0,
+		10, 0, 6, 0, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0, 0,
+		8, 0, 38, 0, 0x3c, 0x14, 0, 0,
+		11, 0, 52, 0, 'H', 'o', 'm', 'e', 'N', 'e', 't', 0,
+	}
+	sysTestNl80211Station = []byte{
+		72, 0, 0, 0, 28, 0, 2, 0, 1, 0, 0, 0, 0, 0, 0, 0,
+		19, 1, 0, 0,
+		8, 0, 3, 0, 3, 0, 0, 0,
+		10, 0, 6, 0, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff, 0, 0,
+		32, 0, 21, 0x80,
+		5, 0, 7, 0, 0xc8, 0, 0, 0,
+		20, 0, 8, 0x80,
+		8, 0, 5, 0, 0xdb, 0x21, 0, 0,
+		6, 0, 1, 0, 0xdb, 0x21, 0, 0,
+		// NLMSG_DONE
+		20, 0, 0, 0, 3, 0, 2, 0, 1, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0,
+	}
+	sysTestNetlinkError = []byte{
+		36, 0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0,
+		0xed, 0xff, 0xff, 0xff,
+		20, 0, 0, 0, 28, 0, 1, 0, 1, 0, 0, 0, 0, 0, 0, 0,
+	}
+)
+
+func TestParseNl80211(t *testing.T) {
+	msgs, done, err := parseNetlinkMessages(sysTestGenlFamily)
+	assert.Nil(t, err)
+	assert.True(t, done)
+	family, err := parseGenlFamilyID(msgs)
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(28), family)
+
+	wifi := sysResponseWifi{}
+	msgs, done, err = parseNetlinkMessages(sysTestNl80211Interface)
+	assert.Nil(t, err)
+	assert.True(t, done)
+	parseNl80211(msgs, &wifi)
+	assert.Equal(t, sysResponseWifi{SSID: "HomeNet", Frequency: 5180}, wifi)
+
+	msgs, done, err = parseNetlinkMessages(sysTestNl80211Station)
+	assert.Nil(t, err)
+	assert.True(t, done)
+	assert.Len(t, msgs, 1)
+	parseNl80211(msgs, &wifi)
+	assert.Equal(t, sysResponseWifi{
+		SSID:      "HomeNet",
+		BSSID:     "aa:bb:cc:dd:ee:ff",
+		Signal:    -56,
+		Bitrate:   866.7,
+		Frequency: 5180,
+	}, wifi)
+
+	// Multipart reply without NLMSG_DONE yet.
+	msgs, done, err = parseNetlinkMessages(sysTestNl80211Station[:72])
+	assert.Nil(t, err)
+	assert.False(t, done)
+	assert.Len(t, msgs, 1)
+
+	_, done, err = parseNetlinkMessages(sysTestNetlinkError)
+	assert.True(t, done)
+	assert.Equal(t, syscall.ENODEV, err)
+
+	_, _, err = parseNetlinkMessages(sysTestNl80211Interface[:40])
+	assert.NotNil(t, err)
+}
+
+func TestGenlMessage(t *testing.T) {
+	msg := genlMessage(genlIDCtrl, 1, ctrlCmdGetFamily,
+		netlinkAttr(ctrlAttrFamilyName, []byte("nl80211\x00")))
+	msgs, _, err := parseNetlinkMessages(msg)
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, uint16(genlIDCtrl), msgs[0].Type)
+	assert.Equal(t, []byte("nl80211\x00"), parseNetlinkAttrs(msgs[0].Data[4:])[ctrlAttrFamilyName])
+}
+
+func sysTestProcessStat(pid int, name string, ticks, start, rss uint64) string {
+	return fmt.Sprintf("%d (%s) S 1 1 1 0 -1 0 0 0 0 0 %d 0 0 0 20 0 1 0 %d 0 %d 0\n",
+		pid, name, ticks, start, rss)
+}
+
+func TestSysTop(t *testing.T) {
+	s, cleanup := newTestSys(t, []interface{}{"top 2", "top 2 mem !fire*"}, map[string]string{
+		"proc/stat":    "cpu  1000 0 0 1000 0 0 0 0 0 0\ncpu0 0\ncpu1 0\n",
+		"proc/1/stat":  sysTestProcessStat(1, "init", 100, 1, 100),
+		"proc/20/stat": sysTestProcessStat(20, "firefox", 10, 5, 5000),
+		"proc/30/stat": sysTestProcessStat(30, "my (odd) proc", 50, 7, 300),
+		"proc/40/stat": "40 (short) S 1",
+	})
+	defer cleanup()
+	page := uint64(os.Getpagesize())
+
+	value, err := s.Get()
+	assert.Nil(t, err)
+	top := value.(sysResponse).Top
+	// No CPU usage before the second poll.
+	assert.Equal(t, []int{1, 20}, sysTestPIDs(top["cpu"]))
+	assert.Equal(t, float64(0), top["cpu"][0].CPU)
+	assert.Equal(t, []int{30, 1}, sysTestPIDs(top["mem"]))
+	assert.Equal(t, "my (odd) proc", top["mem"][0].Name)
+	assert.Equal(t, 300*page, top["mem"][0].RSSBytes)
+
+	writeFakeFiles(t, s.procfs, map[string]string{
+		"stat":    "cpu  1200 0 0 1200 0 0 0 0 0 0\ncpu0 0\ncpu1 0\n",
+		"1/stat":  sysTestProcessStat(1, "init", 150, 1, 100),
+		"20/stat": sysTestProcessStat(20, "firefox", 210, 5, 5000),
+		// PID was reused by another process.
+		"30/stat": sysTestProcessStat(30, "other", 60, 9, 300),
+	})
+	value, err = s.Get()
+	assert.Nil(t, err)
+	top = value.(sysResponse).Top
+	assert.Equal(t, []int{20, 1}, sysTestPIDs(top["cpu"]))
+	assert.Equal(t, float64(100), top["cpu"][0].CPU)
+	assert.Equal(t, float64(25), top["cpu"][1].CPU)
+	assert.Equal(t, "firefox", top["cpu"][0].Name)
+}
+
+func sysTestPIDs(processes []sysResponseProcess) []int {
+	pids := []int{}
+	for _, process := range processes {
+		pids = append(pids, process.PID)
+	}
+	return pids
+}
+
+func TestSysMetricIntervals(t *testing.T) {
+	s, cleanup := newTestSys(t, []interface{}{
+		"load",
+		map[string]interface{}{"metric": "procs", "interval": "1h"},
+		map[string]interface{}{"metric": "temp thermal", "interval": "1h"},
+	}, map[string]string{
+		"proc/loadavg":                         "0.52 0.58 0.59 3/467 12345\n",
+		"proc/stat":                            sysTestProcStat,
+		"proc/1/stat":                          "1 (systemd) S 0 1 1 0 -1",
+		"sys/class/thermal/thermal_zone0/type": "acpitz\n",
+		"sys/class/thermal/thermal_zone0/temp": "27800\n",
+	})
+	defer cleanup()
+
+	value, err := s.Get()
+	assert.Nil(t, err)
+	resp := value.(sysResponse)
+	assert.Equal(t, 0.52, resp.Load.Load1)
+	assert.Equal(t, uint64(1), resp.Procs.Total)
+	assert.Equal(t, 27.8, resp.Temp["thermal"]["acpitz"].Current)
+
+	writeFakeFiles(t, s.procfs, map[string]string{
+		"loadavg": "1.52 0.58 0.59 3/467 12345\n",
+		"stat":    "procs_running 5\n",
+		"2/stat":  "2 (kthreadd) S 0 0 0 0 -1",
+	})
+	writeFakeFiles(t, s.sysfs, map[string]string{
+		"class/thermal/thermal_zone0/temp": "50000\n",
+	})
+	// Modifying the returned response must not affect cached values.
+	resp.Temp["thermal"]["acpitz"] = sysResponseTemp{}
+	resp.Temp["other"] = nil
+
+	value, err = s.Get()
+	assert.Nil(t, err)
+	resp = value.(sysResponse)
+	assert.Equal(t, 1.52, resp.Load.Load1)
+	assert.Equal(t, uint64(1), resp.Procs.Total)
+	assert.Equal(t, uint64(3), resp.Procs.Running)
+	assert.Equal(t, 27.8, resp.Temp["thermal"]["acpitz"].Current)
+	assert.NotContains(t, resp.Temp, "other")
+}
+
+var SysInitTests = []struct {
+	metric interface{}
+	valid  bool
+}{
+	{"load", true},
+	{map[string]interface{}{"metric": "load"}, true},
+	{map[string]interface{}{"metric": "load", "interval": "1m"}, true},
+	{map[string]interface{}{"metric": "load", "interval": "soon"}, false},
+	{map[string]interface{}{"interval": "1m"}, false},
+	{int64(5), false},
+}
+
+// Invalid metrics do not fail Init, so they are not reported over
+// and over again by Worker retrying it.
+func TestSysInit(t *testing.T) {
+	for i, tt := range SysInitTests {
+		logR.Reset()
+		s := &Sys{}
+		assert.Nil(t, s.Init(config{"metrics": []interface{}{tt.metric}}), "%d", i)
+		assert.Equal(t, tt.valid, len(s.metrics) == 1, "%d", i)
+		assert.Equal(t, !tt.valid, strings.Contains(logR.String(), "No valid metrics"), "%d", i)
+
+		value, err := s.Get()
+		assert.Nil(t, err, "%d", i)
+		assert.NotNil(t, value, "%d", i)
+	}
+	assert.NotNil(t, (&Sys{}).Init(config{}))
+	assert.NotNil(t, (&Sys{}).Init(config{"metrics": "load"}))
+}
+
+var SysParseMetricsTests = []struct {
+	metric   interface{}
+	expected string
+}{
+	{"load", "load"},
+	{"  Disk   /   /home ", "Disk / /home"},
+	{map[string]interface{}{"metric": "cpu", "args": []interface{}{"times", true}}, "cpu times true"},
+	{map[string]interface{}{"metric": "top 3", "args": []interface{}{"mem"}}, "top 3 mem"},
+	{map[string]interface{}{"metric": "load", "interval": "1m"}, "load"},
+	{"cpu", ""},
+	{"cpu percent maybe", ""},
+	{"cpu times true false", ""},
+	{"cpu hotness", ""},
+	{"load 1", ""},
+	{"disk", ""},
+	{"diskio", ""},
+	{"wifi", ""},
+	{"top", ""},
+	{"top -1", ""},
+	{"top many", ""},
+	{"nonexistent", ""},
+	{"", ""},
+	{map[string]interface{}{"metric": "load", "interval": "soon"}, ""},
+	{map[string]interface{}{"metric": "disk", "args": "/"}, ""},
+	{map[string]interface{}{"interval": "1m"}, ""},
+	{int64(5), ""},
+}
+
+func TestSysParseMetrics(t *testing.T) {
+	s := &Sys{}
+	for i, tt := range SysParseMetricsTests {
+		logR.Reset()
+		metrics := s.parseMetrics([]interface{}{tt.metric})
+		if tt.expected == "" {
+			assert.Len(t, metrics, 0, "%d", i)
+			assert.Contains(t, logR.String(), "Sys: ", "%d", i)
+			continue
+		}
+		if assert.Len(t, metrics, 1, "%d", i) {
+			assert.Equal(t, tt.expected, metrics[0].metric, "%d", i)
+			assert.NotNil(t, metrics[0].collect, "%d", i)
+		}
+	}
+}
+
+func TestSysUptime(t *testing.T) {
+	s, cleanup := newTestSys(t, []interface{}{"uptime"}, map[string]string{
+		"proc/uptime": "273812.52 1043920.91\n",
+		"proc/stat":   sysTestProcStat + "btime 1760000000\n",
+	})
+	defer cleanup()
+
+	value, err := s.Get()
+	assert.Nil(t, err)
+	resp := value.(sysResponse)
+	assert.Equal(t, uint64(1760000000), resp.BootTime)
+	assert.Equal(t, 273812520*time.Millisecond, resp.Uptime.Duration)
+	assert.Equal(t, 3, resp.Uptime.Days)
+	assert.Equal(t, 4, resp.Uptime.Hours)
+	assert.Equal(t, 3, resp.Uptime.Minutes)
+	assert.Equal(t, 1043920910*time.Millisecond, resp.Uptime.Idle)
+	assert.Equal(t, "3d 4h 3m", resp.Uptime.String())
+	assert.Equal(t, "4h 3m", sysResponseUptime{Hours: 4, Minutes: 3}.String())
+}
+
+func TestSysCgroupV2(t *testing.T) {
+	s, cleanup := newTestSys(t, []interface{}{"cgroup"}, map[string]string{
+		"proc/self/cgroup":                           "0::/user.slice/app.scope\n",
+		"cgroup/cgroup.controllers":                  "cpu memory pids\n",
+		"cgroup/user.slice/app.scope/memory.current": "104857600\n",
+		"cgroup/user.slice/app.scope/memory.max":     "209715200\n",
+		"cgroup/user.slice/app.scope/memory.stat":    "anon 100663296\ninactive_file 4194304\n",
+		"cgroup/user.slice/app.scope/cpu.stat":       "usage_usec 1000000\nuser_usec 800000\n",
+		"cgroup/user.slice/app.scope/cpu.max":        "50000 100000\n",
+		"cgroup/user.slice/app.scope/pids.current":   "12\n",
+		"cgroup/user.slice/app.scope/pids.max":       "max\n",
+	})
+	defer cleanup()
+
+	value, err := s.Get()
+	assert.Nil(t, err)
+	cgroup := value.(sysResponse).Cgroup["self"]
+	assert.Equal(t, 2, cgroup.Version)
+	assert.Equal(t, uint64(100663296), cgroup.Memory.UsedBytes)
+	assert.Equal(t, uint64(209715200), cgroup.Memory.LimitBytes)
+	assert.Equal(t, float64(48), cgroup.Memory.Percent)
+	assert.Equal(t, 0.5, cgroup.CPU.Quota)
+	assert.Equal(t, float64(0), cgroup.CPU.Usage)
+	assert.Equal(t, uint64(12), cgroup.Pids.Current)
+	assert.Equal(t, uint64(0), cgroup.Pids.Limit)
+
+	now := time.Now()
+	samples := make(rates)
+	_, err = s.getCgroup(samples, "/user.slice/app.scope", now)
+	assert.Nil(t, err)
+	writeFakeFiles(t, s.cgroupfs, map[string]string{
+		"user.slice/app.scope/cpu.stat": "usage_usec 1500000\n",
+	})
+	cgroup, err = s.getCgroup(samples, "/user.slice/app.scope", now.Add(2*time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, 0.25, cgroup.CPU.Usage)
+	assert.Equal(t, float64(50), cgroup.CPU.Percent)
+
+	// Metrics covering the same cgroup do not share samples.
+	s.metrics = s.parseMetrics([]interface{}{
+		"cgroup /user.slice/app.scope", "cgroup /user.slice/app.scope /user.slice",
+	})
+	_, err = s.Get()
+	assert.Nil(t, err)
+	writeFakeFiles(t, s.cgroupfs, map[string]string{
+		"user.slice/app.scope/cpu.stat": "usage_usec 2500000\n",
+	})
+	time.Sleep(10 * time.Millisecond)
+	value, err = s.Get()
+	assert.Nil(t, err)
+	assert.NotZero(t, value.(sysResponse).Cgroup["/user.slice/app.scope"].CPU.Usage)
+
+	// Error of an earlier cgroup is kept, even if later ones succeed.
+	metrics := s.parseMetrics([]interface{}{"cgroup /missing.slice /user.slice/app.scope"})
+	resp := sysResponse{}
+	assert.NotNil(t, metrics[0].collect(&resp, &sysPoll{now: now}))
+	assert.Equal(t, uint64(12), resp.Cgroup["/user.slice/app.scope"].Pids.Current)
+	assert.Contains(t, resp.Cgroup, "/missing.slice")
+}
+
+func TestSysCgroupV1(t *testing.T) {
+	s, cleanup := newTestSys(t, []interface{}{"cgroup"}, map[string]string{
+		"proc/self/cgroup": "12:pids:/docker/abc\n5:cpu,cpuacct:/docker/abc\n" +
+			"4:memory:/docker/abc\n1:name=systemd:/docker/abc\n",
+		// Container sees its own cgroup as the root.
+		"cgroup/memory/memory.usage_in_bytes":  "52428800\n",
+		"cgroup/memory/memory.limit_in_bytes":  "9223372036854771712\n",
+		"cgroup/memory/memory.stat":            "cache 0\ntotal_inactive_file 0\n",
+		"cgroup/cpu,cpuacct/cpuacct.usage":     "2000000000\n",
+		"cgroup/cpu,cpuacct/cpu.cfs_quota_us":  "-1\n",
+		"cgroup/cpu,cpuacct/cpu.cfs_period_us": "100000\n",
+		"cgroup/pids/pids.current":             "3\n",
+		"cgroup/pids/pids.max":                 "100\n",
+	})
+	defer cleanup()
+
+	value, err := s.Get()
+	assert.Nil(t, err)
+	cgroup := value.(sysResponse).Cgroup["self"]
+	assert.Equal(t, 1, cgroup.Version)
+	assert.Equal(t, s.cgroupfs+"/memory", cgroup.Path)
+	assert.Equal(t, uint64(52428800), cgroup.Memory.UsedBytes)
+	assert.Equal(t, uint64(0), cgroup.Memory.LimitBytes)
+	assert.Equal(t, "", cgroup.Memory.Limit)
+	assert.Equal(t, float64(0), cgroup.CPU.Quota)
+	assert.Equal(t, uint64(3), cgroup.Pids.Current)
+	assert.Equal(t, uint64(100), cgroup.Pids.Limit)
+
+	os.RemoveAll(s.cgroupfs)
+	_, err = s.getCgroup(make(rates), "", time.Now())
+	assert.NotNil(t, err)
+}
+
+func TestSysPressure(t *testing.T) {
+	s, cleanup := newTestSys(t, []interface{}{"pressure memory IO"}, map[string]string{
+		"proc/pressure/memory": "some avg10=1.50 avg60=0.75 avg300=0.20 total=123456\n" +
+			"full avg10=0.50 avg60=0.25 avg300=0.10 total=6543\n",
+		"proc/pressure/io": "some avg10=0.00 avg60=0.00 avg300=0.00 total=0\n" +
+			"full avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+	})
+	defer cleanup()
+
+	value, err := s.Get()
+	assert.Nil(t, err)
+	pressure := value.(sysResponse).Pressure
+	assert.Equal(t, sysResponsePressure{
+		Some: sysResponsePressureStall{Avg10: 1.5, Avg60: 0.75, Avg300: 0.2, Total: 123456 * time.Microsecond},
+		Full: sysResponsePressureStall{Avg10: 0.5, Avg60: 0.25, Avg300: 0.1, Total: 6543 * time.Microsecond},
+	}, pressure["memory"])
+	assert.Equal(t, sysResponsePressure{}, pressure["io"])
+	assert.Len(t, s.parseMetrics([]interface{}{"pressure disk"}), 0)
+
+	// Error of an earlier resource is kept, even if later ones succeed.
+	metrics := s.parseMetrics([]interface{}{"pressure cpu memory"})
+	resp := sysResponse{}
+	assert.NotNil(t, metrics[0].collect(&resp, &sysPoll{now: time.Now()}))
+	assert.Equal(t, 6543*time.Microsecond, resp.Pressure["memory"].Full.Total)
+}
+
+var SysPressureTriggerTests = []struct {
+	trigger string
+	path    string
+	line    string
+}{
+	{"memory some 150ms 1s", "pressure/memory", "some 150000 1000000"},
+	{"CPU full 1s 2s", "pressure/cpu", "full 1000000 2000000"},
+	{"memory some 150ms", "", ""},
+	{"disk some 150ms 1s", "", ""},
+	{"memory half 150ms 1s", "", ""},
+	{"memory some soon 1s", "", ""},
+	{"memory some 2s 1s", "", ""},
+}
+
+func TestSysPressureTrigger(t *testing.T) {
+	s := &Sys{procfs: "/proc"}
+	for i, tt := range SysPressureTriggerTests {
+		path, line, err := s.parsePressureTrigger(tt.trigger)
+		if tt.line == "" {
+			assert.NotNil(t, err, "%d", i)
+			continue
+		}
+		assert.Nil(t, err, "%d", i)
+		assert.Equal(t, "/proc/"+tt.path, path, "%d", i)
+		assert.Equal(t, tt.line, line, "%d", i)
+	}
+}
+
+func TestSysPressureEvented(t *testing.T) {
+	s, cleanup := newTestSys(t, []interface{}{
+		map[string]interface{}{"metric": "pressure memory", "interval": "1h"},
+	}, map[string]string{
+		"proc/pressure/memory": "some avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+	})
+	defer cleanup()
+	assert.False(t, s.Evented())
+
+	value, err := s.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, float64(0), value.(sysResponse).Pressure["memory"].Some.Avg10)
+
+	s.pressure = make(chan struct{}, 1)
+	s.interval = time.Hour
+	assert.True(t, s.Evented())
+	writeFakeFiles(t, s.procfs, map[string]string{
+		"pressure/memory": "some avg10=12.00 avg60=3.00 avg300=1.00 total=100\n",
+	})
+	s.pressure <- struct{}{}
+	// Event refreshes pressure, even though its interval did not pass yet.
+	value, err = s.GetEvented()
+	assert.Nil(t, err)
+	assert.Equal(t, float64(12), value.(sysResponse).Pressure["memory"].Some.Avg10)
+}
@@ -0,0 +1,380 @@
+// osop
+// Copyright (C) 2026 Karol 'Kenji Takahashi' Woźniak
+//
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+// OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+var timerPhases = []string{"work", "break", "long break"}
+
+// timerState is what gets persisted between osop runs.
+type timerState struct {
+	Running bool
+	Started time.Time
+	Elapsed time.Duration
+	Phase   int
+	Round   int
+}
+
+type timerResponse struct {
+	Mode      string
+	Running   bool
+	Done      bool
+	Elapsed   time.Duration
+	Remaining time.Duration
+	Deadline  time.Time
+	Phase     string
+	Round     int
+}
+
+type Timer struct {
+	mode     string
+	interval time.Duration
+	deadline func(now time.Time) (time.Time, bool)
+
+	durations [3]time.Duration
+	rounds    int
+
+	state     timerState
+	statePath string
+	commands  chan string
+	ticker    *time.Ticker
+}
+
+// parseTimerDeadline returns a function, which computes the next deadline.
+//
+// Accepts TOML datetimes, "daily 15:04", "weekly Monday 15:04"
+// and a few common date layouts. Returned boolean tells whether
+// the deadline is recurring.
+func parseTimerDeadline(until interface{}) (func(now time.Time) (time.Time, bool), error) {
+	if deadline, ok := until.(time.Time); ok {
+		return func(now time.Time) (time.Time, bool) { return deadline, false }, nil
+	}
+	s, ok := until.(string)
+	if !ok {
+		return nil, fmt.Errorf("Wrong `until` parameter: `%v`", until)
+	}
+
+	split := strings.Fields(strings.ToLower(s))
+	if len(split) > 0 && (split[0] == "daily" || split[0] == "weekly") {
+		weekday := -1
+		if split[0] == "weekly" {
+			if len(split) < 2 {
+				return nil, fmt.Errorf("`weekly` requires a weekday")
+			}
+			// At least three letters are required, so that
+			// the prefix is never ambiguous (e.g. "t" or "s").
+			for i := time.Sunday; i <= time.Saturday && len(split[1]) >= 3; i++ {
+				if strings.HasPrefix(strings.ToLower(i.String()), split[1]) {
+					weekday = int(i)
+					break
+				}
+			}
+			if weekday == -1 {
+				return nil, fmt.Errorf("Unknown weekday `%s`", split[1])
+			}
+			split = split[1:]
+		}
+		if len(split) < 2 {
+			return nil, fmt.Errorf("`%s` requires a time", s)
+		}
+		clock, err := time.Parse("15:04", split[1])
+		if err != nil {
+			return nil, fmt.Errorf("Cannot parse time `%s`: `%s`", split[1], err)
+		}
+		return func(now time.Time) (time.Time, bool) {
+			next := time.Date(
+				now.Year(), now.Month(), now.Day(),
+				clock.Hour(), clock.Minute(), 0, 0, now.Location(),
+			)
+			if weekday != -1 {
+				next = next.AddDate(0, 0, (weekday-int(now.Weekday())+7)%7)
+			}
+			for !next.After(now) {
+				if weekday != -1 {
+					next = next.AddDate(0, 0, 7)
+				} else {
+					next = next.AddDate(0, 0, 1)
+				}
+			}
+			return next, true
+		}, nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		deadline, err := time.ParseInLocation(layout, s, time.Local)
+		if err == nil {
+			return func(now time.Time) (time.Time, bool) { return deadline, false }, nil
+		}
+	}
+	return nil, fmt.Errorf("Cannot parse `until` parameter: `%s`", s)
+}
+
+func (t *Timer) elapsed(now time.Time) time.Duration {
+	if !t.state.Running {
+		return t.state.Elapsed
+	}
+	return t.state.Elapsed + now.Sub(t.state.Started)
+}
+
+// nextPhase moves pomodoro to the next phase, carrying `leftover` time over.
+func (t *Timer) nextPhase(now time.Time, leftover time.Duration) {
+	if t.state.Phase == 0 {
+		if t.state.Round%t.rounds == 0 {
+			t.state.Phase = 2
+		} else {
+			t.state.Phase = 1
+		}
+	} else {
+		t.state.Phase = 0
+		t.state.Round += 1
+	}
+	t.state.Elapsed = leftover
+	t.state.Started = now
+}
+
+func (t *Timer) reset() {
+	t.state = timerState{Round: 1}
+}
+
+func (t *Timer) apply(command string, now time.Time) error {
+	switch command {
+	case "start":
+		if !t.state.Running {
+			t.state.Running = true
+			t.state.Started = now
+		}
+	case "stop":
+		t.state.Elapsed = t.elapsed(now)
+		t.state.Running = false
+	case "toggle":
+		if t.state.Running {
+			return t.apply("stop", now)
+		}
+		return t.apply("start", now)
+	case "reset":
+		t.reset()
+	case "skip":
+		if t.mode != "pomodoro" {
+			return fmt.Errorf("`skip` is only available in pomodoro mode")
+		}
+		t.nextPhase(now, 0)
+	default:
+		return fmt.Errorf("Unknown command `%s`", command)
+	}
+	t.save()
+	return nil
+}
+
+func (t *Timer) save() {
+	data, err := json.Marshal(t.state)
+	if err == nil {
+		err = ioutil.WriteFile(t.statePath, data, 0644)
+	}
+	if err != nil {
+		log.Printf("Timer: Cannot save state: `%s`\n", err)
+	}
+}
+
+func (t *Timer) load() {
+	data, err := ioutil.ReadFile(t.statePath)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &t.state)
+	}
+	if err != nil {
+		log.Printf("Timer: Cannot load state: `%s`\n", err)
+	}
+}
+
+func (t *Timer) getAt(now time.Time) timerResponse {
+	resp := timerResponse{Mode: t.mode, Running: t.state.Running}
+	switch t.mode {
+	case "countdown":
+		var recurring bool
+		resp.Deadline, recurring = t.deadline(now)
+		resp.Remaining = resp.Deadline.Sub(now)
+		resp.Running = recurring || resp.Remaining > 0
+		if resp.Remaining <= 0 {
+			resp.Remaining = 0
+			resp.Done = true
+		}
+	case "stopwatch":
+		resp.Elapsed = t.elapsed(now)
+	case "pomodoro":
+		elapsed := t.elapsed(now)
+		changed := false
+		for elapsed >= t.durations[t.state.Phase] {
+			t.nextPhase(now, elapsed-t.durations[t.state.Phase])
+			elapsed = t.state.Elapsed
+			changed = true
+		}
+		if changed {
+			t.save()
+		}
+		resp.Elapsed = elapsed
+		resp.Remaining = t.durations[t.state.Phase] - elapsed
+		resp.Deadline = now.Add(resp.Remaining)
+		resp.Phase = timerPhases[t.state.Phase]
+		resp.Round = t.state.Round
+	}
+	resp.Elapsed = resp.Elapsed / time.Second * time.Second
+	resp.Remaining = (resp.Remaining + time.Second - 1) / time.Second * time.Second
+	return resp
+}
+
+func (t *Timer) Get() (interface{}, error) {
+	return t.getAt(time.Now()), nil
+}
+
+func (t *Timer) SetInterval(interval time.Duration) {
+	if interval == t.interval || interval <= 0 {
+		return
+	}
+	t.interval = interval
+	t.ticker.Stop()
+	t.ticker = time.NewTicker(interval)
+}
+
+func (t *Timer) GetEvented() (interface{}, error) {
+	select {
+	case command := <-t.commands:
+		if err := t.apply(command, time.Now()); err != nil {
+			return nil, err
+		}
+	case <-t.ticker.C:
+	}
+	return t.Get()
+}
+
+// listen reads commands, one per line, from control FIFO.
+func (t *Timer) listen(fifo *os.File) {
+	scanner := bufio.NewScanner(fifo)
+	for scanner.Scan() {
+		command := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if command != "" {
+			t.commands <- command
+		}
+	}
+	log.Printf("Timer: Cannot read commands: `%s`\n", scanner.Err())
+}
+
+func (t *Timer) Init(config config) error {
+	t.mode = "countdown"
+	if config["mode"] != nil {
+		t.mode = strings.ToLower(config["mode"].(string))
+	}
+
+	t.interval = time.Second
+	if config["pollInterval"] != nil {
+		interval, err := time.ParseDuration(config["pollInterval"].(string))
+		if err == nil && interval > 0 {
+			t.interval = interval
+		}
+	}
+	switch t.mode {
+	case "countdown":
+		if config["until"] == nil {
+			return fmt.Errorf("Until parameter is required for countdown Timer")
+		}
+		deadline, err := parseTimerDeadline(config["until"])
+		if err != nil {
+			return err
+		}
+		t.deadline = deadline
+		t.ticker = time.NewTicker(t.interval)
+		return nil
+	case "pomodoro":
+		t.durations = [3]time.Duration{25 * time.Minute, 5 * time.Minute, 15 * time.Minute}
+		for i, name := range []string{"work", "break", "longBreak"} {
+			if config[name] == nil {
+				continue
+			}
+			duration, err := time.ParseDuration(config[name].(string))
+			if err != nil || duration <= 0 {
+				return fmt.Errorf("Wrong `%s` parameter: `%s`", name, config[name])
+			}
+			t.durations[i] = duration
+		}
+		t.rounds = 4
+		if config["rounds"] != nil {
+			t.rounds = int(config["rounds"].(int64))
+		}
+		if t.rounds < 1 {
+			return fmt.Errorf("Rounds parameter must be positive")
+		}
+	case "stopwatch":
+	default:
+		return fmt.Errorf("Unknown Timer mode `%s`", t.mode)
+	}
+
+	if config["control"] == nil {
+		return fmt.Errorf("Control parameter is required for %s Timer", t.mode)
+	}
+	control := config["control"].(string)
+	if err := mkfifo(control); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("Cannot create control FIFO: `%s`", err)
+	}
+	// Opening for writing as well, so we never get EOF
+	// when the other side closes.
+	fifo, err := os.OpenFile(control, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("Cannot open control FIFO: `%s`", err)
+	}
+
+	if config["state"] != nil {
+		t.statePath = config["state"].(string)
+	} else {
+		t.statePath, err = xdg.DataFile(path.Join(
+			"osop", "timer-"+filepath.Base(control)+".json",
+		))
+		if err != nil {
+			fifo.Close()
+			return fmt.Errorf("Cannot get state file location: `%s`", err)
+		}
+	}
+	t.reset()
+	t.load()
+
+	t.ticker = time.NewTicker(t.interval)
+	t.commands = make(chan string)
+	go t.listen(fifo)
+	return nil
+}
+
+func init() {
+	registry.AddReceiver("Timer", &Timer{}, timerResponse{})
+}
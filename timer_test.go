@@ -0,0 +1,140 @@
+// osop
+// Copyright (C) 2026 Karol 'Kenji Takahashi' Woźniak
+//
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+// OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var timerTestTime = time.Date(2026, time.March, 4, 12, 0, 0, 0, time.Local)
+
+var ParseTimerDeadlineTests = []struct {
+	until     interface{}
+	expected  time.Time
+	recurring bool
+}{
+	{timerTestTime.Add(time.Hour), timerTestTime.Add(time.Hour), false},
+	{"2026-03-05 10:30", time.Date(2026, time.March, 5, 10, 30, 0, 0, time.Local), false},
+	{"2026-03-05", time.Date(2026, time.March, 5, 0, 0, 0, 0, time.Local), false},
+	{"daily 17:30", time.Date(2026, time.March, 4, 17, 30, 0, 0, time.Local), true},
+	{"daily 12:00", time.Date(2026, time.March, 5, 12, 0, 0, 0, time.Local), true},
+	{"weekly fri 09:00", time.Date(2026, time.March, 6, 9, 0, 0, 0, time.Local), true},
+	{"weekly Wednesday 11:00", time.Date(2026, time.March, 11, 11, 0, 0, 0, time.Local), true},
+	{"weekly THU 09:00", time.Date(2026, time.March, 5, 9, 0, 0, 0, time.Local), true},
+}
+
+func TestParseTimerDeadline(t *testing.T) {
+	for _, tt := range ParseTimerDeadlineTests {
+		deadline, err := parseTimerDeadline(tt.until)
+		assert.Nil(t, err)
+		result, recurring := deadline(timerTestTime)
+		assert.Equal(t, tt.expected, result)
+		assert.Equal(t, tt.recurring, recurring)
+	}
+
+	for _, until := range []interface{}{1, "weekly 12:00", "weekly t 17:30", "weekly sa 10:00", "weekly fridays 9:00", "daily", "daily 25:00", "tomorrow"} {
+		_, err := parseTimerDeadline(until)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestTimerPomodoro(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osop")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	timer := &Timer{}
+	err = timer.Init(config{
+		"mode":    "pomodoro",
+		"work":    "10m",
+		"break":   "2m",
+		"rounds":  int64(2),
+		"control": filepath.Join(dir, "control"),
+		"state":   filepath.Join(dir, "state.json"),
+	})
+	assert.Nil(t, err)
+
+	resp := timer.getAt(timerTestTime)
+	assert.Equal(t, timerResponse{
+		Mode: "pomodoro", Phase: "work", Round: 1, Remaining: 10 * time.Minute,
+		Deadline: timerTestTime.Add(10 * time.Minute),
+	}, resp)
+
+	assert.Nil(t, timer.apply("start", timerTestTime))
+	resp = timer.getAt(timerTestTime.Add(11 * time.Minute))
+	assert.Equal(t, "break", resp.Phase)
+	assert.Equal(t, time.Minute, resp.Elapsed)
+	assert.Equal(t, time.Minute, resp.Remaining)
+
+	resp = timer.getAt(timerTestTime.Add(23 * time.Minute))
+	assert.Equal(t, "long break", resp.Phase)
+	assert.Equal(t, 2, resp.Round)
+	assert.Equal(t, 14*time.Minute, resp.Remaining)
+
+	assert.Nil(t, timer.apply("toggle", timerTestTime.Add(24*time.Minute)))
+	assert.Nil(t, timer.apply("skip", timerTestTime.Add(30*time.Minute)))
+	resp = timer.getAt(timerTestTime.Add(40 * time.Minute))
+	assert.Equal(t, "work", resp.Phase)
+	assert.Equal(t, 3, resp.Round)
+	assert.False(t, resp.Running)
+	assert.Equal(t, time.Duration(0), resp.Elapsed)
+
+	// State is persisted.
+	restored := &Timer{statePath: timer.statePath}
+	restored.load()
+	assert.True(t, timer.state.Started.Equal(restored.state.Started))
+	restored.state.Started = timer.state.Started
+	assert.Equal(t, timer.state, restored.state)
+
+	assert.NotNil(t, timer.apply("rewind", timerTestTime))
+}
+
+func TestTimerStopwatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osop")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	timer := &Timer{}
+	err = timer.Init(config{
+		"mode":    "stopwatch",
+		"control": filepath.Join(dir, "control"),
+		"state":   filepath.Join(dir, "state.json"),
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, timer.apply("start", timerTestTime))
+	assert.Nil(t, timer.apply("stop", timerTestTime.Add(90*time.Second)))
+	assert.Nil(t, timer.apply("start", timerTestTime.Add(time.Hour)))
+	resp := timer.getAt(timerTestTime.Add(time.Hour + 30*time.Second))
+	assert.Equal(t, 2*time.Minute, resp.Elapsed)
+	assert.True(t, resp.Running)
+	assert.NotNil(t, timer.apply("skip", timerTestTime))
+
+	assert.Nil(t, timer.apply("reset", timerTestTime))
+	assert.Equal(t, time.Duration(0), timer.getAt(timerTestTime).Elapsed)
+}
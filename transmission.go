@@ -27,105 +27,55 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
-	"strconv"
-
-	"github.com/pyk/byten"
 )
 
-func bytonizeByte(data []byte, speed bool, short bool) (string, error) {
-	i, err := strconv.ParseInt(string(data), 0, 0)
-	if err != nil {
-		return "", err
-	}
-	b := byten.Size(i)
-	if short {
-		p := b[len(b)-2]
-		if p < '0' || p > '9' {
-			b = b[:len(b)-1]
-		}
-	}
-	if speed {
-		b += "/s"
-	}
-	return b, nil
-}
-
-type stringByten string
-
-func (s *stringByten) UnmarshalJSON(data []byte) error {
-	b, err := bytonizeByte(data, false, false)
-	*s = stringByten(b)
-	return err
-}
-
-type stringBytenShort string
-
-func (s *stringBytenShort) UnmarshalJSON(data []byte) error {
-	b, err := bytonizeByte(data, false, true)
-	*s = stringBytenShort(b)
-	return err
-}
-
-type stringBytenSpeed string
-
-func (s *stringBytenSpeed) UnmarshalJSON(data []byte) error {
-	b, err := bytonizeByte(data, true, false)
-	*s = stringBytenSpeed(b)
-	return err
-}
-
-type stringBytenSpeedShort string
-
-func (s *stringBytenSpeedShort) UnmarshalJSON(data []byte) error {
-	b, err := bytonizeByte(data, true, true)
-	*s = stringBytenSpeedShort(b)
-	return err
-}
-
 type Transmission struct {
 	url       string
 	sessionId string
-	shorts    bool
 	client    *http.Client
 }
 
+// transmissionResponseStats holds raw numbers only. Humanized values
+// are methods, so they are formatted with Osop byte format settings
+// when the template is rendered.
 type transmissionResponseStats struct {
-	Uploaded      stringByten `json:"uploadedBytes"`
-	Downloaded    stringByten `json:"downloadedBytes"`
-	FilesAdded    uint64
-	SessionCount  uint64
-	SecondsActive uint64
+	UploadedBytes   uint64 `json:"uploadedBytes"`
+	DownloadedBytes uint64 `json:"downloadedBytes"`
+	FilesAdded      uint64
+	SessionCount    uint64
+	SecondsActive   uint64
 }
 
-type transmissionResponseStatsShort struct {
-	Uploaded      stringBytenShort `json:"uploadedBytes"`
-	Downloaded    stringBytenShort `json:"downloadedBytes"`
-	FilesAdded    uint64
-	SessionCount  uint64
-	SecondsActive uint64
+func (s transmissionResponseStats) Uploaded() string {
+	return byteFormat.Format(float64(s.UploadedBytes))
 }
 
+func (s transmissionResponseStats) Downloaded() string {
+	return byteFormat.Format(float64(s.DownloadedBytes))
+}
+
+// transmissionResponse is decoded directly from the RPC response.
 type transmissionResponse struct {
 	TorrentCount       uint64
 	ActiveTorrentCount uint64
 	PausedTorrentCount uint64
-	DownloadSpeed      stringBytenSpeed
-	UploadSpeed        stringBytenSpeed
+	DownloadSpeedBytes uint64                    `json:"downloadSpeed"`
+	UploadSpeedBytes   uint64                    `json:"uploadSpeed"`
 	Cumulative         transmissionResponseStats `json:"cumulative-stats"`
 	Current            transmissionResponseStats `json:"current-stats"`
 }
 
-type transmissionResponseShort struct {
-	TorrentCount       uint64
-	ActiveTorrentCount uint64
-	PausedTorrentCount uint64
-	DownloadSpeed      stringBytenSpeedShort
-	UploadSpeed        stringBytenSpeedShort
-	Cumulative         transmissionResponseStatsShort `json:"cumulative-stats"`
-	Current            transmissionResponseStatsShort `json:"current-stats"`
+func (r transmissionResponse) DownloadSpeed() string {
+	return byteFormat.Format(float64(r.DownloadSpeedBytes)) + "/s"
 }
 
-func (t *Transmission) Get() (interface{}, error) {
+func (r transmissionResponse) UploadSpeed() string {
+	return byteFormat.Format(float64(r.UploadSpeedBytes)) + "/s"
+}
+
+// request sends a single session-stats request. Returns nil response
+// (and remembers the new session id) when session id has to be renewed.
+func (t *Transmission) request() (*transmissionResponse, error) {
 	req, err := http.NewRequest(
 		"POST", t.url, bytes.NewBufferString(`{"method":"session-stats"}`),
 	)
@@ -138,29 +88,36 @@ func (t *Transmission) Get() (interface{}, error) {
 		return nil, fmt.Errorf("Cannot send request: `%s`", err)
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode == 409 {
+	if resp.StatusCode == http.StatusConflict {
 		t.sessionId = resp.Header.Get("X-Transmission-Session-Id")
-		return t.Get()
+		return nil, nil
 	}
-	if resp.StatusCode != 200 {
+	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("Wrong status code: `%d`", resp.StatusCode)
 	}
 
-	decoder := json.NewDecoder(resp.Body)
-	decoder.UseNumber()
-	if t.shorts {
-		var data struct {
-			Arguments transmissionResponseShort
-		}
-		decoder.Decode(&data)
-		return data.Arguments, nil
-	} else {
-		var data struct {
-			Arguments transmissionResponse
+	var data struct {
+		Arguments transmissionResponse
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("Cannot decode response: `%s`", err)
+	}
+	return &data.Arguments, nil
+}
+
+func (t *Transmission) Get() (interface{}, error) {
+	resp, err := t.request()
+	if err == nil && resp == nil {
+		// Session id was renewed, try again once.
+		resp, err = t.request()
+		if err == nil && resp == nil {
+			err = fmt.Errorf("Cannot obtain session id")
 		}
-		decoder.Decode(&data)
-		return data.Arguments, nil
 	}
+	if err != nil {
+		return nil, err
+	}
+	return *resp, nil
 }
 
 func (t *Transmission) Init(config config) error {
@@ -180,10 +137,6 @@ func (t *Transmission) Init(config config) error {
 	t.url = _url.String()
 	t.client = &http.Client{}
 
-	if config["shorts"] != nil {
-		t.shorts = config["shorts"].(bool)
-	}
-
 	return nil
 }
 
@@ -0,0 +1,168 @@
+// osop
+// Copyright (C) 2026 Karol 'Kenji Takahashi' Woźniak
+//
+// Permission is hereby granted, free of charge, to any person obtaining
+// a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation
+// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the
+// Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+// OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var transmissionTestStats = `{
+	"arguments": {
+		"activeTorrentCount": 2,
+		"cumulative-stats": {
+			"downloadedBytes": 1610612736,
+			"filesAdded": 120,
+			"secondsActive": 864000,
+			"sessionCount": 14,
+			"uploadedBytes": 536870912
+		},
+		"current-stats": {
+			"downloadedBytes": 1536,
+			"filesAdded": 3,
+			"secondsActive": 3600,
+			"sessionCount": 1,
+			"uploadedBytes": 512
+		},
+		"downloadSpeed": 2048,
+		"pausedTorrentCount": 1,
+		"torrentCount": 3,
+		"uploadSpeed": 0
+	},
+	"result": "success"
+}`
+
+// newTestTransmission creates Transmission talking to a fake server,
+// which requires a session id and then responds with given body.
+// Returned counter tells how many requests were made.
+func newTestTransmission(t *testing.T, sessionId, body string) (*Transmission, *int, func()) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests += 1
+		assert.Equal(t, "/transmission/rpc", r.URL.Path)
+		if r.Header.Get("X-Transmission-Session-Id") != sessionId {
+			w.Header().Set("X-Transmission-Session-Id", sessionId)
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+
+	tr := &Transmission{}
+	assert.Nil(t, tr.Init(config{"address": server.URL}))
+	return tr, &requests, server.Close
+}
+
+func TestTransmission(t *testing.T) {
+	tr, requests, cleanup := newTestTransmission(t, "abc", transmissionTestStats)
+	defer cleanup()
+
+	value, err := tr.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, *requests)
+	resp := value.(transmissionResponse)
+	assert.Equal(t, uint64(3), resp.TorrentCount)
+	assert.Equal(t, uint64(2), resp.ActiveTorrentCount)
+	assert.Equal(t, uint64(1), resp.PausedTorrentCount)
+	assert.Equal(t, uint64(2048), resp.DownloadSpeedBytes)
+	assert.Equal(t, uint64(536870912), resp.Cumulative.UploadedBytes)
+	assert.Equal(t, uint64(14), resp.Cumulative.SessionCount)
+	assert.Equal(t, uint64(3600), resp.Current.SecondsActive)
+
+	// Session id is kept for the following requests.
+	_, err = tr.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, *requests)
+}
+
+var TransmissionRenderTests = []struct {
+	config   map[string]interface{}
+	expected string
+}{
+	{map[string]interface{}{}, "2.0KiB/s 0B/s 1.5GiB 512B"},
+	{map[string]interface{}{"byteUnits": "si", "byteShorts": true}, "2.0k/s 0B/s 1.6G 512B"},
+	{map[string]interface{}{"bytePrecision": int64(2)}, "2.00KiB/s 0B/s 1.50GiB 512B"},
+}
+
+// Humanized values follow Osop byte format settings, the same as `speed` action.
+func TestTransmissionRender(t *testing.T) {
+	tr, _, cleanup := newTestTransmission(t, "abc", transmissionTestStats)
+	defer cleanup()
+	value, err := tr.Get()
+	assert.Nil(t, err)
+
+	defer func(format ByteFormat) { byteFormat = format }(byteFormat)
+	tmpl := template.Must(template.New("t").Funcs(templateFuncs).Parse(
+		"{{.DownloadSpeed}} {{.UploadSpeed}} {{.Cumulative.Downloaded}} {{.Current.Uploaded}}" +
+			"|{{speed .DownloadSpeedBytes}}",
+	))
+	for i, tt := range TransmissionRenderTests {
+		byteFormat = NewByteFormat(tt.config)
+		var buf bytes.Buffer
+		assert.Nil(t, tmpl.Execute(&buf, value), "%d", i)
+		expected := tt.expected + "|" + strings.SplitN(tt.expected, " ", 2)[0]
+		assert.Equal(t, expected, buf.String(), "%d", i)
+	}
+
+	// Zero value renders too, before the first response arrives.
+	byteFormat = NewByteFormat(map[string]interface{}{})
+	var buf bytes.Buffer
+	tmpl = template.Must(template.New("t").Parse("{{.DownloadSpeed}} {{.Current.Downloaded}}"))
+	assert.Nil(t, tmpl.Execute(&buf, transmissionResponse{}))
+	assert.Equal(t, "0B/s 0B", buf.String())
+}
+
+func TestTransmissionErrors(t *testing.T) {
+	tr, _, cleanup := newTestTransmission(t, "abc", `{"arguments": {"torrentCount": "three"`)
+	defer cleanup()
+	_, err := tr.Get()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Cannot decode response")
+
+	// Server which never accepts the session id.
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests += 1
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer server.Close()
+	tr = &Transmission{}
+	assert.Nil(t, tr.Init(config{"address": server.URL}))
+	_, err = tr.Get()
+	assert.Equal(t, "Cannot obtain session id", err.Error())
+	assert.Equal(t, 2, requests)
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	tr = &Transmission{}
+	assert.Nil(t, tr.Init(config{"address": server.URL}))
+	_, err = tr.Get()
+	assert.Equal(t, "Wrong status code: `401`", err.Error())
+}